@@ -0,0 +1,235 @@
+package telestage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+var (
+	ErrAccessDenied = errors.New("access denied")
+)
+
+const rolesKey = "telestage.roles"
+
+// Roles of chat members resolved by ChatAdminRoles.
+const (
+	RoleChatCreator = "chat_creator"
+	RoleChatAdmin   = "chat_admin"
+)
+
+// RoleResolver returns the roles of the sender of the update.
+type RoleResolver func(ctx Context) ([]string, error)
+
+// StaticRoles resolves the roles of users by ID.
+func StaticRoles(roles map[int64][]string) RoleResolver {
+	return func(ctx Context) ([]string, error) {
+		if u := ctx.Sender(); u != nil {
+			return roles[u.ID], nil
+		}
+		return nil, nil
+	}
+}
+
+// ChatAdminRoles resolves RoleChatCreator and RoleChatAdmin from the status
+// of the sender in the group the update comes from.
+func ChatAdminRoles() RoleResolver {
+	return func(ctx Context) ([]string, error) {
+		c, u := ctx.Chat(), ctx.Sender()
+		if c == nil || u == nil || c.IsPrivate() {
+			return nil, nil
+		}
+
+		m, err := ctx.Bot().GetChatMember(tgbotapi.GetChatMemberConfig{
+			ChatConfigWithUser: tgbotapi.ChatConfigWithUser{ChatID: c.ID, UserID: u.ID},
+		})
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case m.IsCreator():
+			return []string{RoleChatCreator, RoleChatAdmin}, nil
+		case m.IsAdministrator():
+			return []string{RoleChatAdmin}, nil
+		}
+		return nil, nil
+	}
+}
+
+// AccessControl resolves the roles of senders and guards routes and scenes
+// with the roles or permissions they require:
+//
+//	ac := telestage.NewAccessControl(telestage.StaticRoles(map[int64][]string{42: {"admin"}}))
+//	ac.Grant("admin", "users.ban")
+//	scene.OnCommand("ban", ban, ac.RequirePermission("users.ban"))
+type AccessControl struct {
+	// OnDenied is called instead of the handler when access is denied, with
+	// an error wrapping ErrAccessDenied or the error of a resolver.
+	// It replies with a text by default.
+	OnDenied func(ctx Context, err error)
+
+	lock        sync.RWMutex
+	resolvers   []RoleResolver
+	permissions map[string][]string
+}
+
+// NewAccessControl creates an AccessControl with the roles of senders
+// combined from the resolvers.
+func NewAccessControl(resolvers ...RoleResolver) *AccessControl {
+	return &AccessControl{
+		OnDenied:    replyDenied,
+		resolvers:   resolvers,
+		permissions: map[string][]string{},
+	}
+}
+
+func replyDenied(ctx Context, _ error) {
+	const text = "You are not allowed to do that."
+	if q := ctx.Upd().CallbackQuery; q != nil {
+		_, _ = ctx.Bot().Request(tgbotapi.NewCallback(q.ID, text))
+		return
+	}
+	if ctx.Chat() != nil {
+		_, _ = ctx.Reply(text)
+	}
+}
+
+// Grant grants the permissions to the role.
+func (ac *AccessControl) Grant(role string, permissions ...string) {
+	ac.lock.Lock()
+	defer ac.lock.Unlock()
+
+	ac.permissions[role] = append(ac.permissions[role], permissions...)
+}
+
+// Roles returns the roles of the sender. They are resolved once per update and cached in the context.
+func (ac *AccessControl) Roles(ctx Context) ([]string, error) {
+	if roles, ok := ctx.Get(ac.rolesKey()).([]string); ok {
+		return roles, nil
+	}
+
+	roles := []string{}
+	seen := map[string]bool{}
+	for _, resolve := range ac.resolvers {
+		resolved, err := resolve(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("resolve roles: %w", err)
+		}
+		for _, r := range resolved {
+			if !seen[r] {
+				seen[r] = true
+				roles = append(roles, r)
+			}
+		}
+	}
+	ctx.Set(ac.rolesKey(), roles)
+	return roles, nil
+}
+
+// rolesKey is the context key of the roles resolved by this instance, so
+// instances with different resolvers don't share the cache
+func (ac *AccessControl) rolesKey() string {
+	return fmt.Sprintf("%s.%p", rolesKey, ac)
+}
+
+// HasRole reports whether the sender has any of the roles.
+func (ac *AccessControl) HasRole(ctx Context, roles ...string) (bool, error) {
+	has, err := ac.Roles(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, r := range roles {
+		if contains(has, r) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Can reports whether a role of the sender grants the permission.
+func (ac *AccessControl) Can(ctx Context, permission string) (bool, error) {
+	roles, err := ac.Roles(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	ac.lock.RLock()
+	defer ac.lock.RUnlock()
+
+	for _, r := range roles {
+		if contains(ac.permissions[r], permission) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Require allows the route or the scene to senders with any of the roles.
+func (ac *AccessControl) Require(roles ...string) Middleware {
+	return ac.guard(func(ctx Context) error {
+		return ac.requireRoles(ctx, roles)
+	})
+}
+
+// RequireRouteRoles denies the routes to senders without any of the roles
+// declared with Route.Roles, it is meant for Scene.Use.
+func (ac *AccessControl) RequireRouteRoles() Middleware {
+	return ac.guard(func(ctx Context) error {
+		r := CurrentRoute(ctx)
+		if r == nil || len(r.roles) == 0 {
+			return nil
+		}
+		return ac.requireRoles(ctx, r.roles)
+	})
+}
+
+func (ac *AccessControl) requireRoles(ctx Context, roles []string) error {
+	ok, err := ac.HasRole(ctx, roles...)
+	if err == nil && !ok {
+		err = fmt.Errorf("%w: requires role %s", ErrAccessDenied, strings.Join(roles, " or "))
+	}
+	return err
+}
+
+// RequirePermission allows the route or the scene to senders granted all the permissions.
+func (ac *AccessControl) RequirePermission(permissions ...string) Middleware {
+	return ac.guard(func(ctx Context) error {
+		for _, p := range permissions {
+			ok, err := ac.Can(ctx, p)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return fmt.Errorf("%w: requires permission %s", ErrAccessDenied, p)
+			}
+		}
+		return nil
+	})
+}
+
+func (ac *AccessControl) guard(check func(Context) error) Middleware {
+	return func(next EventFn) EventFn {
+		return func(ctx Context) {
+			if err := check(ctx); err != nil {
+				Abort(ctx)
+				if ac.OnDenied != nil {
+					ac.OnDenied(ctx, err)
+				}
+				return
+			}
+			next(ctx)
+		}
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
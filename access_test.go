@@ -0,0 +1,129 @@
+package telestage
+
+import (
+	"errors"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessControl_Roles(t *testing.T) {
+	var calls int
+	ac := NewAccessControl(
+		StaticRoles(map[int64][]string{1: {"admin", "editor"}}),
+		func(ctx Context) ([]string, error) {
+			calls++
+			return []string{"editor", "beta"}, nil
+		},
+	)
+	ac.Grant("editor", "posts.edit")
+
+	ctx := groupMessage(-1, 1, "hi")
+	roles, err := ac.Roles(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"admin", "editor", "beta"}, roles)
+
+	ok, err := ac.HasRole(ctx, "moderator", "beta")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, _ = ac.Can(ctx, "posts.edit")
+	assert.True(t, ok)
+	ok, _ = ac.Can(ctx, "posts.delete")
+	assert.False(t, ok)
+	assert.Equal(t, 1, calls, "roles are cached in the context")
+
+	roles, _ = ac.Roles(groupMessage(-1, 2, "hi"))
+	assert.Equal(t, []string{"editor", "beta"}, roles)
+}
+
+func TestAccessControl_SeparateCaches(t *testing.T) {
+	staff := NewAccessControl(StaticRoles(map[int64][]string{42: {"admin"}}))
+	other := NewAccessControl(StaticRoles(map[int64][]string{}))
+
+	ctx := groupMessage(-1, 42, "hi")
+	ok, err := staff.HasRole(ctx, "admin")
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = other.HasRole(ctx, "admin")
+	require.NoError(t, err)
+	assert.False(t, ok, "roles of another instance must not leak")
+}
+
+func TestAccessControl_Require(t *testing.T) {
+	srv, bot := newTestBot(t)
+
+	var handled []string
+	var denied []error
+	ac := NewAccessControl(StaticRoles(map[int64][]string{1: {"admin"}}))
+	ac.Grant("admin", "users.ban")
+	ac.OnDenied = func(ctx Context, err error) {
+		denied = append(denied, err)
+		replyDenied(ctx, err)
+	}
+
+	s := NewScene()
+	s.OnCommand("ban", func(Context) { handled = append(handled, "ban") }, ac.RequirePermission("users.ban"))
+	s.OnCommand("stats", func(Context) { handled = append(handled, "stats") }, ac.Require("admin", "analyst"))
+	var after int
+	s.After(func(Context) { after++ })
+	var aborted []bool
+	stage := NewStage(func(Context) string { return "main" })
+	stage.Add("main", s)
+	stage.Observe(func(_ Context, info UpdateInfo) { aborted = append(aborted, info.Aborted) })
+
+	command := func(userID int64, text string) tgbotapi.Update {
+		upd := userMessage(userID, 1, text)
+		upd.Message.Entities = []tgbotapi.MessageEntity{{Type: "bot_command", Length: len(text)}}
+		return upd
+	}
+	require.NoError(t, stage.Run(bot, command(1, "/ban")))
+	require.NoError(t, stage.Run(bot, command(1, "/stats")))
+	require.NoError(t, stage.Run(bot, command(2, "/ban")))
+	require.NoError(t, stage.Run(bot, command(2, "/stats")))
+
+	assert.Equal(t, []string{"ban", "stats"}, handled)
+	assert.Equal(t, 2, after, "after hooks must not run for denied updates")
+	assert.Equal(t, []bool{false, false, true, true}, aborted)
+	require.Len(t, denied, 2)
+	assert.True(t, errors.Is(denied[0], ErrAccessDenied))
+	assert.EqualError(t, denied[0], "access denied: requires permission users.ban")
+	assert.EqualError(t, denied[1], "access denied: requires role admin or analyst")
+
+	calls := srv.CallsTo("sendMessage")
+	require.Len(t, calls, 2)
+	assert.Equal(t, "You are not allowed to do that.", calls[0].Params.Get("text"))
+}
+
+func TestChatAdminRoles(t *testing.T) {
+	srv, bot := newTestBot(t)
+	srv.SetChatMember(-1, tgbotapi.ChatMember{User: &tgbotapi.User{ID: 1}, Status: "creator"})
+	srv.SetChatMember(-1, tgbotapi.ChatMember{User: &tgbotapi.User{ID: 2}, Status: "administrator"})
+
+	resolve := ChatAdminRoles()
+	roles := func(ctx *NativeContext) []string {
+		ctx.bot = bot
+		r, err := resolve(ctx)
+		require.NoError(t, err)
+		return r
+	}
+	assert.Equal(t, []string{RoleChatCreator, RoleChatAdmin}, roles(groupMessage(-1, 1, "hi")))
+	assert.Equal(t, []string{RoleChatAdmin}, roles(groupMessage(-1, 2, "hi")))
+	assert.Empty(t, roles(groupMessage(-1, 3, "hi")))
+
+	upd := userMessage(1, 1, "hi")
+	assert.Empty(t, roles(&NativeContext{upd: &upd}), "private chats have no admins")
+	assert.Len(t, srv.CallsTo("getChatMember"), 3)
+
+	srv.FailNext("getChatMember", 400, "Bad Request: chat not found", 0)
+	ac := NewAccessControl(resolve)
+	var denied error
+	ac.OnDenied = func(_ Context, err error) { denied = err }
+	ctx := groupMessage(-1, 1, "hi")
+	ctx.bot = bot
+	ac.Require(RoleChatAdmin)(func(Context) { t.Fatal("must be denied") })(ctx)
+	assert.Error(t, denied)
+	assert.False(t, errors.Is(denied, ErrAccessDenied))
+}
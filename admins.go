@@ -0,0 +1,248 @@
+package telestage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+var (
+	ErrBotRights = errors.New("bot lacks chat rights")
+)
+
+// Administrator rights of chat members, named as in the Bot API.
+const (
+	RightManageChat       = "can_manage_chat"
+	RightChangeInfo       = "can_change_info"
+	RightDeleteMessages   = "can_delete_messages"
+	RightRestrictMembers  = "can_restrict_members"
+	RightPromoteMembers   = "can_promote_members"
+	RightInviteUsers      = "can_invite_users"
+	RightPinMessages      = "can_pin_messages"
+	RightManageVideoChats = "can_manage_video_chats"
+	RightPostMessages     = "can_post_messages"
+	RightEditMessages     = "can_edit_messages"
+)
+
+var chatRights = map[string]func(tgbotapi.ChatMember) bool{
+	RightManageChat:       func(m tgbotapi.ChatMember) bool { return m.CanManageChat },
+	RightChangeInfo:       func(m tgbotapi.ChatMember) bool { return m.CanChangeInfo },
+	RightDeleteMessages:   func(m tgbotapi.ChatMember) bool { return m.CanDeleteMessages },
+	RightRestrictMembers:  func(m tgbotapi.ChatMember) bool { return m.CanRestrictMembers },
+	RightPromoteMembers:   func(m tgbotapi.ChatMember) bool { return m.CanPromoteMembers },
+	RightInviteUsers:      func(m tgbotapi.ChatMember) bool { return m.CanInviteUsers },
+	RightPinMessages:      func(m tgbotapi.ChatMember) bool { return m.CanPinMessages },
+	RightManageVideoChats: func(m tgbotapi.ChatMember) bool { return m.CanManageVideoChats },
+	RightPostMessages:     func(m tgbotapi.ChatMember) bool { return m.CanPostMessages },
+	RightEditMessages:     func(m tgbotapi.ChatMember) bool { return m.CanEditMessages },
+}
+
+// HasRights reports whether the member is an administrator with all the
+// rights, the creator of the chat has all rights.
+func HasRights(m tgbotapi.ChatMember, rights ...string) bool {
+	if m.IsCreator() {
+		return true
+	}
+	if !m.IsAdministrator() {
+		return false
+	}
+	for _, r := range rights {
+		if has, ok := chatRights[r]; !ok || !has(m) {
+			return false
+		}
+	}
+	return true
+}
+
+type chatAdminsEntry struct {
+	admins  map[int64]tgbotapi.ChatMember
+	expires time.Time
+}
+
+// ChatAdmins checks administrators of groups and their rights, caching
+// getChatAdministrators per chat. The cache of a chat is invalidated by
+// chat_member and my_chat_member updates seen by Observer, those must be
+// enabled in allowed updates of the bot.
+//
+//	admins := telestage.NewChatAdmins(5 * time.Minute)
+//	stg.Observe(admins.Observer())
+//	groupScene.OnCommand("ban", ban,
+//		admins.RequireBotRights(telestage.RightRestrictMembers),
+//		admins.RequireAdmin(telestage.RightRestrictMembers))
+type ChatAdmins struct {
+	TTL time.Duration
+	// OnDenied is called instead of the handler when the sender is not an
+	// admin with the rights, with an error wrapping ErrAccessDenied, or when
+	// the bot lacks rights, with an error wrapping ErrBotRights.
+	// It replies with a text by default.
+	OnDenied func(ctx Context, err error)
+
+	lock  sync.Mutex
+	chats map[int64]chatAdminsEntry
+}
+
+func NewChatAdmins(ttl time.Duration) *ChatAdmins {
+	return &ChatAdmins{
+		TTL:      ttl,
+		OnDenied: replyAdminDenied,
+		chats:    map[int64]chatAdminsEntry{},
+	}
+}
+
+func replyAdminDenied(ctx Context, err error) {
+	if errors.Is(err, ErrBotRights) {
+		if ctx.Chat() != nil {
+			_, _ = ctx.Reply("I need administrator rights to do that.")
+		}
+		return
+	}
+	replyDenied(ctx, err)
+}
+
+// Admins returns the administrators of the chat by user ID.
+func (a *ChatAdmins) Admins(ctx Context, chatID int64) (map[int64]tgbotapi.ChatMember, error) {
+	return a.admins(ctx, chatID, time.Now())
+}
+
+func (a *ChatAdmins) admins(ctx Context, chatID int64, now time.Time) (map[int64]tgbotapi.ChatMember, error) {
+	a.lock.Lock()
+	entry, ok := a.chats[chatID]
+	a.lock.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.admins, nil
+	}
+
+	members, err := ctx.Bot().GetChatAdministrators(tgbotapi.ChatAdministratorsConfig{
+		ChatConfig: tgbotapi.ChatConfig{ChatID: chatID},
+	})
+	if err != nil {
+		return nil, err
+	}
+	admins := make(map[int64]tgbotapi.ChatMember, len(members))
+	for _, m := range members {
+		if m.User != nil {
+			admins[m.User.ID] = m
+		}
+	}
+
+	a.lock.Lock()
+	a.chats[chatID] = chatAdminsEntry{admins: admins, expires: now.Add(a.TTL)}
+	a.lock.Unlock()
+	return admins, nil
+}
+
+// Invalidate forgets the cached administrators of the chat.
+func (a *ChatAdmins) Invalidate(chatID int64) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	delete(a.chats, chatID)
+}
+
+// Observer returns the UpdateObserver invalidating the cache of chats on
+// changes of their members, to add with Stage.Observe.
+func (a *ChatAdmins) Observer() UpdateObserver {
+	return func(ctx Context, _ UpdateInfo) {
+		for _, u := range []*tgbotapi.ChatMemberUpdated{ctx.Upd().ChatMember, ctx.Upd().MyChatMember} {
+			if u != nil {
+				a.Invalidate(u.Chat.ID)
+			}
+		}
+	}
+}
+
+// IsAdmin reports whether the sender is an administrator of the group with all the rights.
+func (a *ChatAdmins) IsAdmin(ctx Context, rights ...string) (bool, error) {
+	c, u := ctx.Chat(), ctx.Sender()
+	if c == nil || u == nil || c.IsPrivate() {
+		return false, nil
+	}
+	return a.hasRights(ctx, c.ID, u.ID, rights)
+}
+
+// BotHasRights reports whether the bot is an administrator of the group with all the rights.
+func (a *ChatAdmins) BotHasRights(ctx Context, rights ...string) (bool, error) {
+	c := ctx.Chat()
+	if c == nil || c.IsPrivate() {
+		return false, nil
+	}
+	return a.hasRights(ctx, c.ID, ctx.Bot().Self.ID, rights)
+}
+
+func (a *ChatAdmins) hasRights(ctx Context, chatID, userID int64, rights []string) (bool, error) {
+	admins, err := a.Admins(ctx, chatID)
+	if err != nil {
+		return false, err
+	}
+	m, ok := admins[userID]
+	return ok && HasRights(m, rights...), nil
+}
+
+// Roles returns a RoleResolver of RoleChatCreator and RoleChatAdmin like
+// ChatAdminRoles, using the cache.
+func (a *ChatAdmins) Roles() RoleResolver {
+	return func(ctx Context) ([]string, error) {
+		c, u := ctx.Chat(), ctx.Sender()
+		if c == nil || u == nil || c.IsPrivate() {
+			return nil, nil
+		}
+		admins, err := a.Admins(ctx, c.ID)
+		if err != nil {
+			return nil, err
+		}
+		m, ok := admins[u.ID]
+		switch {
+		case !ok:
+			return nil, nil
+		case m.IsCreator():
+			return []string{RoleChatCreator, RoleChatAdmin}, nil
+		default:
+			return []string{RoleChatAdmin}, nil
+		}
+	}
+}
+
+// RequireAdmin allows the route or the scene to administrators of the group with all the rights.
+func (a *ChatAdmins) RequireAdmin(rights ...string) Middleware {
+	return a.guard(func(ctx Context) error {
+		ok, err := a.IsAdmin(ctx, rights...)
+		if err == nil && !ok {
+			err = fmt.Errorf("%w: requires chat admin", ErrAccessDenied)
+			if len(rights) > 0 {
+				err = fmt.Errorf("%w with %s", err, strings.Join(rights, ", "))
+			}
+		}
+		return err
+	})
+}
+
+// RequireBotRights runs the route or the scene only when the bot is an
+// administrator of the group with all the rights.
+func (a *ChatAdmins) RequireBotRights(rights ...string) Middleware {
+	return a.guard(func(ctx Context) error {
+		ok, err := a.BotHasRights(ctx, rights...)
+		if err == nil && !ok {
+			err = fmt.Errorf("%w: %s", ErrBotRights, strings.Join(rights, ", "))
+		}
+		return err
+	})
+}
+
+func (a *ChatAdmins) guard(check func(Context) error) Middleware {
+	return func(next EventFn) EventFn {
+		return func(ctx Context) {
+			if err := check(ctx); err != nil {
+				Abort(ctx)
+				if a.OnDenied != nil {
+					a.OnDenied(ctx, err)
+				}
+				return
+			}
+			next(ctx)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package telestage
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHasRights(t *testing.T) {
+	admin := tgbotapi.ChatMember{Status: "administrator", CanDeleteMessages: true}
+	assert.True(t, HasRights(admin))
+	assert.True(t, HasRights(admin, RightDeleteMessages))
+	assert.False(t, HasRights(admin, RightDeleteMessages, RightRestrictMembers))
+	assert.False(t, HasRights(admin, "can_fly"))
+	assert.True(t, HasRights(tgbotapi.ChatMember{Status: "creator"}, RightRestrictMembers))
+	assert.False(t, HasRights(tgbotapi.ChatMember{Status: "member"}))
+}
+
+func TestChatAdmins_Cache(t *testing.T) {
+	srv, bot := newTestBot(t)
+	srv.SetChatMember(-1, tgbotapi.ChatMember{User: &tgbotapi.User{ID: 1}, Status: "administrator"})
+
+	a := NewChatAdmins(time.Minute)
+	ctx := groupMessage(-1, 1, "hi")
+	ctx.bot = bot
+	now := time.Now()
+
+	admins, err := a.admins(ctx, -1, now)
+	require.NoError(t, err)
+	assert.Contains(t, admins, int64(1))
+	_, err = a.admins(ctx, -1, now.Add(59*time.Second))
+	require.NoError(t, err)
+	assert.Len(t, srv.CallsTo("getChatAdministrators"), 1, "cached")
+
+	srv.SetChatMember(-1, tgbotapi.ChatMember{User: &tgbotapi.User{ID: 2}, Status: "administrator"})
+	admins, _ = a.admins(ctx, -1, now.Add(time.Minute))
+	assert.Contains(t, admins, int64(2), "expired")
+	assert.Len(t, srv.CallsTo("getChatAdministrators"), 2)
+
+	srv.SetChatMember(-1, tgbotapi.ChatMember{User: &tgbotapi.User{ID: 2}, Status: "left"})
+	a.Observer()(&NativeContext{upd: &tgbotapi.Update{ChatMember: &tgbotapi.ChatMemberUpdated{
+		Chat: tgbotapi.Chat{ID: -1},
+	}}}, UpdateInfo{})
+	admins, _ = a.admins(ctx, -1, now.Add(time.Minute))
+	assert.NotContains(t, admins, int64(2), "invalidated by the chat_member update")
+}
+
+func TestChatAdmins_Require(t *testing.T) {
+	srv, bot := newTestBot(t)
+	srv.SetChatMember(-1, tgbotapi.ChatMember{User: &tgbotapi.User{ID: 1}, Status: "administrator", CanRestrictMembers: true})
+	srv.SetChatMember(-1, tgbotapi.ChatMember{User: &tgbotapi.User{ID: 2}, Status: "administrator"})
+
+	var handled []int64
+	var denied []error
+	a := NewChatAdmins(time.Minute)
+	a.OnDenied = func(_ Context, err error) {
+		denied = append(denied, err)
+	}
+
+	s := NewScene()
+	s.OnMessage(func(ctx Context) {
+		handled = append(handled, ctx.Sender().ID)
+	}, a.RequireBotRights(RightRestrictMembers), a.RequireAdmin(RightRestrictMembers))
+	var after int
+	s.After(func(Context) { after++ })
+	stage := NewStage(func(Context) string { return "main" })
+	stage.Add("main", s)
+	stage.Observe(a.Observer())
+
+	run := func(userID int64) {
+		require.NoError(t, stage.Run(bot, *groupMessage(-1, userID, "/ban").upd))
+	}
+	run(1)
+	assert.Empty(t, handled)
+	require.Len(t, denied, 1)
+	assert.True(t, errors.Is(denied[0], ErrBotRights))
+
+	srv.SetChatMember(-1, tgbotapi.ChatMember{User: &bot.Self, Status: "administrator", CanRestrictMembers: true})
+	require.NoError(t, stage.Run(bot, tgbotapi.Update{MyChatMember: &tgbotapi.ChatMemberUpdated{
+		Chat: tgbotapi.Chat{ID: -1, Type: "supergroup"},
+	}}))
+	run(1)
+	run(2)
+	run(3)
+	assert.Equal(t, []int64{1}, handled)
+	assert.Equal(t, 1, after, "after hooks must not run for denied updates")
+	require.Len(t, denied, 3)
+	assert.EqualError(t, denied[1], "access denied: requires chat admin with can_restrict_members")
+	assert.True(t, errors.Is(denied[2], ErrAccessDenied))
+	assert.Len(t, srv.CallsTo("getChatAdministrators"), 2)
+}
+
+func TestChatAdmins_Roles(t *testing.T) {
+	srv, bot := newTestBot(t)
+	srv.SetChatMember(-1, tgbotapi.ChatMember{User: &tgbotapi.User{ID: 1}, Status: "creator"})
+
+	ac := NewAccessControl(NewChatAdmins(time.Minute).Roles())
+	ctx := groupMessage(-1, 1, "hi")
+	ctx.bot = bot
+	roles, err := ac.Roles(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{RoleChatCreator, RoleChatAdmin}, roles)
+}
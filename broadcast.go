@@ -0,0 +1,380 @@
+package telestage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// RecipientIterator yields the recipients of a broadcast.
+type RecipientIterator interface {
+	// Next returns the next chat ID, or false when there are no more recipients.
+	Next() (int64, bool, error)
+}
+
+// RecipientSource opens an iterator over the recipients, skipping the first
+// offset of them so an interrupted broadcast can be resumed. The order of
+// recipients must be stable between calls.
+type RecipientSource func(offset int) (RecipientIterator, error)
+
+type sliceIterator struct {
+	ids []int64
+}
+
+func (it *sliceIterator) Next() (int64, bool, error) {
+	if len(it.ids) == 0 {
+		return 0, false, nil
+	}
+	id := it.ids[0]
+	it.ids = it.ids[1:]
+	return id, true, nil
+}
+
+// SliceRecipients is a RecipientSource over the chat IDs.
+func SliceRecipients(ids []int64) RecipientSource {
+	return func(offset int) (RecipientIterator, error) {
+		if offset > len(ids) {
+			offset = len(ids)
+		}
+		return &sliceIterator{ids: ids[offset:]}, nil
+	}
+}
+
+// MessageTemplate builds the message sent to a recipient.
+type MessageTemplate func(chatID int64) tgbotapi.Chattable
+
+// TextMessage is a MessageTemplate sending the same text to every recipient.
+func TextMessage(text string) MessageTemplate {
+	return func(chatID int64) tgbotapi.Chattable {
+		return tgbotapi.NewMessage(chatID, text)
+	}
+}
+
+// DeliveryStatus is the outcome of sending a broadcast message to a recipient.
+type DeliveryStatus string
+
+const (
+	DeliverySent        DeliveryStatus = "sent"
+	DeliveryBlocked     DeliveryStatus = "blocked"
+	DeliveryDeactivated DeliveryStatus = "deactivated"
+	DeliveryFailed      DeliveryStatus = "failed"
+)
+
+// DeliveryResult is the result of sending a broadcast message to a recipient.
+type DeliveryResult struct {
+	ChatID int64
+	Status DeliveryStatus
+	Err    error
+}
+
+// BroadcastProgress is the checkpoint of a broadcast.
+type BroadcastProgress struct {
+	// Offset is the number of processed recipients.
+	Offset      int
+	Sent        int
+	Blocked     int
+	Deactivated int
+	Failed      int
+	// Done is set when all recipients were processed.
+	Done bool
+}
+
+func (p *BroadcastProgress) add(status DeliveryStatus) {
+	p.Offset++
+	switch status {
+	case DeliverySent:
+		p.Sent++
+	case DeliveryBlocked:
+		p.Blocked++
+	case DeliveryDeactivated:
+		p.Deactivated++
+	default:
+		p.Failed++
+	}
+}
+
+// BroadcastStore persists broadcast checkpoints.
+type BroadcastStore interface {
+	LoadProgress(id string) (BroadcastProgress, bool, error)
+	SaveProgress(id string, p BroadcastProgress) error
+}
+
+// MemoryBroadcastStore is an in-memory BroadcastStore.
+type MemoryBroadcastStore struct {
+	lock     sync.Mutex
+	progress map[string]BroadcastProgress
+}
+
+func NewMemoryBroadcastStore() *MemoryBroadcastStore {
+	return &MemoryBroadcastStore{progress: map[string]BroadcastProgress{}}
+}
+
+func (s *MemoryBroadcastStore) LoadProgress(id string) (BroadcastProgress, bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	p, ok := s.progress[id]
+	return p, ok, nil
+}
+
+func (s *MemoryBroadcastStore) SaveProgress(id string, p BroadcastProgress) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.progress[id] = p
+	return nil
+}
+
+// BroadcastReport is the final report of a broadcast run.
+type BroadcastReport struct {
+	BroadcastProgress
+	Canceled bool
+	Started  time.Time
+	Finished time.Time
+}
+
+// Duration of the run.
+func (r BroadcastReport) Duration() time.Duration {
+	return r.Finished.Sub(r.Started)
+}
+
+// Broadcast sends a message to many recipients, e.g. an announcement to all
+// users of the bot. Progress is checkpointed to the Store, so a broadcast
+// interrupted by a restart resumes from the last checkpoint when run again
+// with the same ID.
+type Broadcast struct {
+	ID         string
+	Bot        *tgbotapi.BotAPI
+	Recipients RecipientSource
+	Message    MessageTemplate
+
+	// Limiter, if set, is used to send messages with PriorityBulk.
+	Limiter *RateLimiter
+	// Store, if set, keeps the progress between runs.
+	Store BroadcastStore
+	// CheckpointEvery is the number of recipients between checkpoints, 100 by default.
+	CheckpointEvery int
+	// OnResult, if set, is called with the result of every recipient.
+	OnResult func(DeliveryResult)
+
+	lock     sync.Mutex
+	progress BroadcastProgress
+	paused   chan struct{}
+	cancel   context.CancelFunc
+}
+
+// NewBroadcast creates a broadcast of the message to the recipients.
+func NewBroadcast(id string, bot *tgbotapi.BotAPI, recipients RecipientSource, message MessageTemplate) *Broadcast {
+	return &Broadcast{
+		ID:         id,
+		Bot:        bot,
+		Recipients: recipients,
+		Message:    message,
+	}
+}
+
+// Run sends the message to all recipients and blocks until it is done,
+// canceled with Cancel or the context is done. An interrupted run reports
+// Canceled and keeps the recipient being sent to for the next run.
+func (b *Broadcast) Run(ctx context.Context) (BroadcastReport, error) {
+	report := BroadcastReport{Started: time.Now()}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	progress, err := b.load()
+	if err != nil {
+		return report, err
+	}
+
+	b.lock.Lock()
+	b.progress = progress
+	b.cancel = cancel
+	b.lock.Unlock()
+
+	mw := []ClientMiddleware{withContext(ctx)}
+	if b.Limiter != nil {
+		mw = append(mw, b.Limiter.Middleware(PriorityBulk))
+	}
+	bot := WrapBot(b.Bot, mw...)
+
+	err = b.run(ctx, bot, progress)
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		report.Canceled = true
+		err = nil
+	}
+
+	report.BroadcastProgress = b.Progress()
+	report.Finished = time.Now()
+	if saveErr := b.save(report.BroadcastProgress); err == nil {
+		err = saveErr
+	}
+
+	return report, err
+}
+
+func (b *Broadcast) run(ctx context.Context, bot *tgbotapi.BotAPI, progress BroadcastProgress) error {
+	if progress.Done {
+		return nil
+	}
+
+	it, err := b.Recipients(progress.Offset)
+	if err != nil {
+		return err
+	}
+
+	every := b.CheckpointEvery
+	if every <= 0 {
+		every = 100
+	}
+
+	for n := 1; ; n++ {
+		if err := b.waitResumed(ctx); err != nil {
+			return err
+		}
+
+		chatID, ok, err := it.Next()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			b.lock.Lock()
+			b.progress.Done = true
+			b.lock.Unlock()
+			return nil
+		}
+
+		result, err := b.send(ctx, bot, chatID)
+		if err != nil {
+			return err
+		}
+
+		b.lock.Lock()
+		b.progress.add(result.Status)
+		progress := b.progress
+		b.lock.Unlock()
+
+		if b.OnResult != nil {
+			b.OnResult(result)
+		}
+		if n%every == 0 {
+			if err := b.save(progress); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// send delivers the message to the recipient, waiting and retrying when
+// Telegram asks to slow down.
+func (b *Broadcast) send(ctx context.Context, bot *tgbotapi.BotAPI, chatID int64) (DeliveryResult, error) {
+	for {
+		_, err := bot.Request(b.Message(chatID))
+		if d, ok := RetryAfter(err); ok {
+			if err := sleep(ctx, d); err != nil {
+				return DeliveryResult{}, err
+			}
+			continue
+		}
+		if err != nil && (ctx.Err() != nil || errors.Is(err, ErrRateLimiterStopped)) {
+			// interrupted before the recipient got the message, it is
+			// neither recorded nor counted so a resumed run sends it
+			return DeliveryResult{}, err
+		}
+
+		return DeliveryResult{
+			ChatID: chatID,
+			Status: deliveryStatus(err),
+			Err:    err,
+		}, nil
+	}
+}
+
+func deliveryStatus(err error) DeliveryStatus {
+	if err == nil {
+		return DeliverySent
+	}
+
+	var apiErr *tgbotapi.Error
+	if errors.As(err, &apiErr) && apiErr.Code == 403 {
+		if strings.Contains(apiErr.Message, "deactivated") {
+			return DeliveryDeactivated
+		}
+		return DeliveryBlocked
+	}
+	return DeliveryFailed
+}
+
+func (b *Broadcast) load() (BroadcastProgress, error) {
+	if b.Store == nil {
+		return BroadcastProgress{}, nil
+	}
+	p, _, err := b.Store.LoadProgress(b.ID)
+	return p, err
+}
+
+func (b *Broadcast) save(p BroadcastProgress) error {
+	if b.Store == nil {
+		return nil
+	}
+	return b.Store.SaveProgress(b.ID, p)
+}
+
+func (b *Broadcast) waitResumed(ctx context.Context) error {
+	b.lock.Lock()
+	paused := b.paused
+	b.lock.Unlock()
+
+	if paused != nil {
+		select {
+		case <-paused:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return ctx.Err()
+}
+
+// Progress returns the current progress of the running broadcast.
+func (b *Broadcast) Progress() BroadcastProgress {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.progress
+}
+
+// Pause stops sending after the current message until Resume is called.
+func (b *Broadcast) Pause() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.paused == nil {
+		b.paused = make(chan struct{})
+	}
+}
+
+// Resume continues a paused broadcast.
+func (b *Broadcast) Resume() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.paused != nil {
+		close(b.paused)
+		b.paused = nil
+	}
+}
+
+// Cancel stops the running broadcast. Run returns a report with Canceled set,
+// and the progress is saved so the broadcast can be resumed later.
+func (b *Broadcast) Cancel() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.cancel != nil {
+		b.cancel()
+	}
+}
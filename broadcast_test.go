@@ -0,0 +1,149 @@
+package telestage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBroadcast_Run(t *testing.T) {
+	srv, bot := newTestBot(t)
+	srv.FailNext("sendMessage", 403, "Forbidden: bot was blocked by the user", 0)
+	srv.FailNext("sendMessage", 403, "Forbidden: user is deactivated", 0)
+	srv.FailNext("sendMessage", 400, "Bad Request: chat not found", 0)
+
+	var results []DeliveryResult
+	b := NewBroadcast("news", bot, SliceRecipients([]int64{1, 2, 3, 4}), TextMessage("hello"))
+	b.OnResult = func(r DeliveryResult) {
+		results = append(results, r)
+	}
+
+	report, err := b.Run(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, BroadcastProgress{Offset: 4, Sent: 1, Blocked: 1, Deactivated: 1, Failed: 1, Done: true}, report.BroadcastProgress)
+	assert.False(t, report.Canceled)
+	require.Len(t, results, 4)
+	assert.Equal(t, []DeliveryStatus{DeliveryBlocked, DeliveryDeactivated, DeliveryFailed, DeliverySent},
+		[]DeliveryStatus{results[0].Status, results[1].Status, results[2].Status, results[3].Status})
+	assert.Equal(t, int64(4), results[3].ChatID)
+}
+
+func TestBroadcast_RetryAfter(t *testing.T) {
+	slept := stubSleep(t)
+	srv, bot := newTestBot(t)
+	srv.FailNext("sendMessage", 429, "Too Many Requests: retry after 2", 2)
+
+	report, err := NewBroadcast("news", bot, SliceRecipients([]int64{1}), TextMessage("hello")).Run(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, report.Sent, "message must be resent after retry_after")
+	assert.Equal(t, []time.Duration{2 * time.Second}, *slept)
+}
+
+func TestBroadcast_Resume(t *testing.T) {
+	srv, bot := newTestBot(t)
+	store := NewMemoryBroadcastStore()
+
+	b := NewBroadcast("news", bot, SliceRecipients([]int64{1, 2, 3, 4}), TextMessage("hello"))
+	b.Store = store
+	b.CheckpointEvery = 1
+	b.OnResult = func(r DeliveryResult) {
+		if r.ChatID == 2 {
+			b.Cancel()
+		}
+	}
+
+	report, err := b.Run(context.Background())
+	require.NoError(t, err)
+	assert.True(t, report.Canceled)
+	assert.Equal(t, 2, report.Sent)
+
+	saved, ok, _ := store.LoadProgress("news")
+	require.True(t, ok)
+	assert.Equal(t, 2, saved.Offset, "progress must be checkpointed on cancel")
+
+	b.OnResult = nil
+	report, err = b.Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 4, report.Sent)
+	assert.True(t, report.Done)
+
+	var chats []string
+	for _, c := range srv.CallsTo("sendMessage") {
+		chats = append(chats, c.Params.Get("chat_id"))
+	}
+	assert.Equal(t, []string{"1", "2", "3", "4"}, chats, "recipients must not receive the message twice")
+
+	_, err = b.Run(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, srv.CallsTo("sendMessage"), 4, "finished broadcast must not be sent again")
+}
+
+func TestBroadcast_Pause(t *testing.T) {
+	srv, bot := newTestBot(t)
+
+	b := NewBroadcast("news", bot, SliceRecipients([]int64{1, 2}), TextMessage("hello"))
+	b.OnResult = func(r DeliveryResult) {
+		if r.ChatID == 1 {
+			b.Pause()
+		}
+	}
+
+	done := make(chan BroadcastReport)
+	go func() {
+		report, _ := b.Run(context.Background())
+		done <- report
+	}()
+
+	assert.Eventually(t, func() bool { return b.Progress().Offset == 1 }, time.Second, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	assert.Len(t, srv.CallsTo("sendMessage"), 1, "paused broadcast must not send")
+
+	b.Resume()
+	report := <-done
+	assert.Equal(t, 2, report.Sent)
+}
+
+func TestBroadcast_Limiter(t *testing.T) {
+	_, bot := newTestBot(t)
+	limiter := NewRateLimiter(RateLimits{Global: Limit{Count: 1, Per: time.Hour}})
+	defer limiter.Stop()
+
+	b := NewBroadcast("news", bot, SliceRecipients([]int64{1, 2}), TextMessage("hello"))
+	b.Limiter = limiter
+	b.OnResult = func(r DeliveryResult) {
+		go b.Cancel()
+	}
+
+	report, err := b.Run(context.Background())
+	require.NoError(t, err)
+	assert.True(t, report.Canceled, "waiting for the limiter must be canceled")
+	assert.Equal(t, 1, report.Sent)
+	assert.Equal(t, 0, limiter.Stats().QueueDepth())
+}
+
+func TestBroadcast_Deadline(t *testing.T) {
+	_, bot := newTestBot(t)
+	limiter := NewRateLimiter(RateLimits{Global: Limit{Count: 1, Per: time.Hour}})
+	defer limiter.Stop()
+	store := NewMemoryBroadcastStore()
+
+	b := NewBroadcast("news", bot, SliceRecipients([]int64{1, 2}), TextMessage("hello"))
+	b.Limiter = limiter
+	b.Store = store
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	report, err := b.Run(ctx)
+	require.NoError(t, err)
+	assert.True(t, report.Canceled)
+	assert.Equal(t, BroadcastProgress{Offset: 1, Sent: 1}, report.BroadcastProgress,
+		"recipient waiting for the limiter must not be counted")
+
+	saved, _, _ := store.LoadProgress("news")
+	assert.Equal(t, 1, saved.Offset)
+}
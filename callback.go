@@ -0,0 +1,137 @@
+package telestage
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// MaxCallbackData is the limit of callback data length in bytes.
+const MaxCallbackData = 64
+
+var (
+	ErrCallbackData = errors.New("invalid callback data")
+)
+
+const callbackParamsKey = "telestage.callback_params"
+
+var callbackParamRe = regexp.MustCompile(`\{(\w+)\}`)
+
+// CallbackRoute is a pattern of callback data like "item:{id}:{action}".
+// The same route produces the data of keyboard buttons and matches it in
+// Scene.OnCallback, so they can't get out of sync.
+type CallbackRoute struct {
+	pattern string
+	params  []string
+	re      *regexp.Regexp
+
+	// codec and prefix are set for routes of CallbackCodec.Route
+	codec  *CallbackCodec
+	prefix string
+}
+
+// NewCallbackRoute creates a route of the pattern. Names in braces are
+// parameters, the rest of the pattern must match literally.
+func NewCallbackRoute(pattern string) *CallbackRoute {
+	r := &CallbackRoute{pattern: pattern}
+
+	var expr strings.Builder
+	expr.WriteByte('^')
+	last := 0
+	for _, m := range callbackParamRe.FindAllStringSubmatchIndex(pattern, -1) {
+		expr.WriteString(regexp.QuoteMeta(pattern[last:m[0]]))
+		expr.WriteString("(.*?)")
+		r.params = append(r.params, pattern[m[2]:m[3]])
+		last = m[1]
+	}
+	expr.WriteString(regexp.QuoteMeta(pattern[last:]))
+	expr.WriteByte('$')
+	r.re = regexp.MustCompile(expr.String())
+
+	return r
+}
+
+func (r *CallbackRoute) Pattern() string {
+	return r.pattern
+}
+
+// Params returns the names of the route parameters in order.
+func (r *CallbackRoute) Params() []string {
+	return r.params
+}
+
+// Data fills the parameters with values in order. It fails when the data is
+// too long or a value can't be matched back, e.g. it contains the separator.
+// Routes of a codec take a single value to encode.
+func (r *CallbackRoute) Data(values ...interface{}) (string, error) {
+	if r.codec != nil {
+		if len(values) != 1 {
+			return "", fmt.Errorf("%w: codec route %q expects a single value, got %d", ErrCallbackData, r.pattern, len(values))
+		}
+		return r.codec.Encode(strings.TrimSuffix(r.prefix, ":"), values[0])
+	}
+	if len(values) != len(r.params) {
+		return "", fmt.Errorf("%w: route %q expects %d values, got %d", ErrCallbackData, r.pattern, len(r.params), len(values))
+	}
+
+	strs := make([]string, len(values))
+	i := 0
+	data := callbackParamRe.ReplaceAllStringFunc(r.pattern, func(string) string {
+		strs[i] = fmt.Sprint(values[i])
+		i++
+		return strs[i-1]
+	})
+
+	if len(data) > MaxCallbackData {
+		return "", fmt.Errorf("%w: %q is longer than %d bytes", ErrCallbackData, data, MaxCallbackData)
+	}
+	params, ok := r.Match(data)
+	for i, name := range r.params {
+		if !ok || params[name] != strs[i] {
+			return "", fmt.Errorf("%w: value %q of %s is ambiguous in route %q", ErrCallbackData, strs[i], name, r.pattern)
+		}
+	}
+
+	return data, nil
+}
+
+// Match reports whether the data belongs to the route and returns its parameters.
+// Data of codec routes matches only if its signature is valid.
+func (r *CallbackRoute) Match(data string) (map[string]string, bool) {
+	if r.codec != nil {
+		if !strings.HasPrefix(data, r.prefix) {
+			return nil, false
+		}
+		payload, err := r.codec.open(r.prefix, data[len(r.prefix):])
+		if err != nil {
+			return nil, false
+		}
+		return map[string]string{"payload": payload}, true
+	}
+
+	m := r.re.FindStringSubmatch(data)
+	if m == nil {
+		return nil, false
+	}
+
+	params := make(map[string]string, len(r.params))
+	for i, name := range r.params {
+		params[name] = m[i+1]
+	}
+	return params, true
+}
+
+// Decode decodes the value of the codec route matched by Scene.OnCallback into v.
+func (r *CallbackRoute) Decode(ctx Context, v interface{}) error {
+	if r.codec == nil {
+		return fmt.Errorf("%w: route %q has no codec", ErrCallbackData, r.pattern)
+	}
+	return decodeCallbackPayload(CallbackParam(ctx, "payload"), v)
+}
+
+// CallbackParam returns the parameter of the callback route matched by Scene.OnCallback.
+func CallbackParam(ctx Context, name string) string {
+	params, _ := ctx.Get(callbackParamsKey).(map[string]string)
+	return params[name]
+}
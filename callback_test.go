@@ -0,0 +1,70 @@
+package telestage
+
+import (
+	"errors"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCallbackRoute(t *testing.T) {
+	r := NewCallbackRoute("item:{id}:{action}")
+	assert.Equal(t, []string{"id", "action"}, r.Params())
+
+	data, err := r.Data(42, "open")
+	require.NoError(t, err)
+	assert.Equal(t, "item:42:open", data)
+
+	params, ok := r.Match(data)
+	require.True(t, ok)
+	assert.Equal(t, map[string]string{"id": "42", "action": "open"}, params)
+
+	_, ok = r.Match("items:42:open")
+	assert.False(t, ok)
+	_, ok = NewCallbackRoute("back").Match("back")
+	assert.True(t, ok, "route without params matches literally")
+}
+
+func TestCallbackRoute_DataErrors(t *testing.T) {
+	r := NewCallbackRoute("item:{id}:{action}")
+
+	tests := []struct {
+		name   string
+		values []interface{}
+	}{
+		{"missing values", []interface{}{1}},
+		{"ambiguous value", []interface{}{"1:2", "open"}},
+		{"too long", []interface{}{1, string(make([]byte, MaxCallbackData))}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := r.Data(tt.values...)
+			assert.True(t, errors.Is(err, ErrCallbackData), err)
+		})
+	}
+}
+
+func TestOnCallback(t *testing.T) {
+	route := NewCallbackRoute("item:{id}")
+	var got string
+	s := NewScene()
+	s.OnCallback(route, func(ctx Context) {
+		got = CallbackParam(ctx, "id")
+	})
+	stage := NewStage(emptyStateGetter)
+	stage.Add("", s)
+
+	data, err := route.Data(7)
+	require.NoError(t, err)
+	stage.Run(&tgbotapi.BotAPI{}, tgbotapi.Update{
+		CallbackQuery: &tgbotapi.CallbackQuery{Data: "other:1"},
+	})
+	assert.Empty(t, got)
+
+	stage.Run(&tgbotapi.BotAPI{}, tgbotapi.Update{
+		CallbackQuery: &tgbotapi.CallbackQuery{Data: data},
+	})
+	assert.Equal(t, "7", got)
+}
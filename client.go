@@ -0,0 +1,111 @@
+package telestage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// ClientMiddleware wraps the HTTP client tgbotapi.BotAPI uses to call the Bot API,
+// e.g. to limit, retry or log outgoing requests.
+type ClientMiddleware func(tgbotapi.HTTPClient) tgbotapi.HTTPClient
+
+// ClientFunc is an adapter to allow the use of ordinary functions as tgbotapi.HTTPClient.
+type ClientFunc func(*http.Request) (*http.Response, error)
+
+// Do calls f(req).
+func (f ClientFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func applyClientMiddleware(c tgbotapi.HTTPClient, middleware ...ClientMiddleware) tgbotapi.HTTPClient {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		c = middleware[i](c)
+	}
+	return c
+}
+
+// WrapBot returns a shallow copy of the bot whose HTTP client is wrapped with middleware.
+// The original bot is left untouched.
+func WrapBot(bot *tgbotapi.BotAPI, mw ...ClientMiddleware) *tgbotapi.BotAPI {
+	wrapped := *bot
+	wrapped.Client = applyClientMiddleware(bot.Client, mw...)
+	return &wrapped
+}
+
+// withContext binds outgoing requests to the context, so they are canceled with it.
+func withContext(ctx context.Context) ClientMiddleware {
+	return func(next tgbotapi.HTTPClient) tgbotapi.HTTPClient {
+		return ClientFunc(func(req *http.Request) (*http.Response, error) {
+			return next.Do(req.WithContext(ctx))
+		})
+	}
+}
+
+// apiMethod returns the Bot API method called by the request, e.g. "sendMessage".
+func apiMethod(req *http.Request) string {
+	return path.Base(req.URL.Path)
+}
+
+// apiParams reads the parameters of a Bot API request. The body is buffered
+// and restored, so the request can still be sent (and resent).
+// Uploaded files are not included into the result.
+func apiParams(req *http.Request) (url.Values, error) {
+	body, err := bufferBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	mediaType, mediaParams, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		return url.ParseQuery(string(body))
+	}
+
+	values := url.Values{}
+	mr := multipart.NewReader(bytes.NewReader(body), mediaParams["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return values, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FileName() != "" {
+			continue
+		}
+		v, err := io.ReadAll(part)
+		if err != nil {
+			return nil, err
+		}
+		values.Add(part.FormName(), string(v))
+	}
+}
+
+// bufferBody reads the request body into memory and makes it replayable through GetBody.
+func bufferBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	req.Body, _ = req.GetBody()
+
+	return body, nil
+}
@@ -0,0 +1,49 @@
+package telestage
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApiParams(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodPost, "https://api.telegram.org/botTOKEN/sendMessage", strings.NewReader("chat_id=1&text=hi"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	params, err := apiParams(req)
+	require.NoError(t, err)
+	assert.Equal(t, "sendMessage", apiMethod(req))
+	assert.Equal(t, "1", params.Get("chat_id"))
+	assert.Equal(t, "hi", params.Get("text"))
+
+	body, _ := io.ReadAll(req.Body)
+	assert.Equal(t, "chat_id=1&text=hi", string(body), "body must be restored")
+}
+
+func TestApiParams_Multipart(t *testing.T) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	w.WriteField("chat_id", "-100")
+	fw, _ := w.CreateFormFile("photo", "cat.jpg")
+	fw.Write([]byte("jpeg"))
+	w.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, "https://api.telegram.org/botTOKEN/sendPhoto", io.NopCloser(&buf))
+	req.Header.Set("Content-Type", w.FormDataContentType())
+
+	params, err := apiParams(req)
+	require.NoError(t, err)
+	assert.Equal(t, "-100", params.Get("chat_id"))
+	assert.Empty(t, params.Get("photo"), "files must not be included")
+
+	require.NotNil(t, req.GetBody, "body must be replayable")
+	r, _ := req.GetBody()
+	body, _ := io.ReadAll(r)
+	assert.Contains(t, string(body), "jpeg")
+}
@@ -0,0 +1,272 @@
+package telestage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// codecSigLen is the length of the encoded signature, 6 bytes of HMAC-SHA256
+const codecSigLen = 8
+
+// CallbackStore keeps callback payloads which don't fit into callback data.
+type CallbackStore interface {
+	// Save stores the payload and returns its short ID.
+	Save(payload string) (string, error)
+	Load(id string) (string, bool, error)
+}
+
+// MemoryCallbackStore is an in-memory CallbackStore. Payloads are identified by
+// their hash, so the same payload is stored once, and are never evicted.
+type MemoryCallbackStore struct {
+	lock     sync.RWMutex
+	payloads map[string]string
+}
+
+func NewMemoryCallbackStore() *MemoryCallbackStore {
+	return &MemoryCallbackStore{payloads: map[string]string{}}
+}
+
+func (s *MemoryCallbackStore) Save(payload string) (string, error) {
+	sum := sha256.Sum256([]byte(payload))
+	id := base64.RawURLEncoding.EncodeToString(sum[:9])
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.payloads[id] = payload
+	return id, nil
+}
+
+func (s *MemoryCallbackStore) Load(id string) (string, bool, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	p, ok := s.payloads[id]
+	return p, ok, nil
+}
+
+// CallbackCodec encodes values into callback data compactly: a struct is
+// encoded as its exported field values in order, without names. Fields tagged
+// `callback:"-"` are skipped. Supported fields are strings, booleans, integers
+// and floats.
+type CallbackCodec struct {
+	// Secret, if set, signs the data with HMAC-SHA256, so tampered data is rejected.
+	Secret []byte
+	// Store, if set, keeps payloads longer than the data limit, the data holds their ID.
+	Store CallbackStore
+}
+
+func NewCallbackCodec(secret []byte, store CallbackStore) *CallbackCodec {
+	return &CallbackCodec{
+		Secret: secret,
+		Store:  store,
+	}
+}
+
+// Route returns a callback route with the name, whose data is the value
+// encoded with the codec. Use CallbackRoute.Decode in its handler.
+func (c *CallbackCodec) Route(name string) *CallbackRoute {
+	r := NewCallbackRoute(name + ":{payload}")
+	r.codec = c
+	r.prefix = name + ":"
+	return r
+}
+
+// Encode returns the callback data of the value for the route name.
+func (c *CallbackCodec) Encode(name string, v interface{}) (string, error) {
+	payload, err := encodeCallbackValue(reflect.ValueOf(v))
+	if err != nil {
+		return "", err
+	}
+
+	data := c.sign(name + ":" + payload)
+	if len(data) <= MaxCallbackData {
+		return data, nil
+	}
+	if c.Store == nil {
+		return "", fmt.Errorf("%w: %q is longer than %d bytes", ErrCallbackData, data, MaxCallbackData)
+	}
+
+	id, err := c.Store.Save(payload)
+	if err != nil {
+		return "", err
+	}
+	data = c.sign(name + ":#" + id)
+	if len(data) > MaxCallbackData {
+		return "", fmt.Errorf("%w: %q is longer than %d bytes", ErrCallbackData, data, MaxCallbackData)
+	}
+	return data, nil
+}
+
+// Decode decodes the callback data made by Encode into the value pointed to by v.
+func (c *CallbackCodec) Decode(data string, v interface{}) error {
+	i := strings.IndexByte(data, ':')
+	if i < 0 {
+		return fmt.Errorf("%w: %q has no route name", ErrCallbackData, data)
+	}
+	payload, err := c.open(data[:i+1], data[i+1:])
+	if err != nil {
+		return err
+	}
+	return decodeCallbackPayload(payload, v)
+}
+
+// open verifies the signature of the body after the prefix and returns the payload, loading it from the store
+func (c *CallbackCodec) open(prefix, body string) (string, error) {
+	if len(c.Secret) > 0 {
+		if len(body) < codecSigLen+1 || body[len(body)-codecSigLen-1] != '.' {
+			return "", fmt.Errorf("%w: missing signature", ErrCallbackData)
+		}
+		signed := prefix + body[:len(body)-codecSigLen-1]
+		if !hmac.Equal([]byte(c.sign(signed)), []byte(prefix+body)) {
+			return "", fmt.Errorf("%w: bad signature", ErrCallbackData)
+		}
+		body = body[:len(body)-codecSigLen-1]
+	}
+
+	if !strings.HasPrefix(body, "#") {
+		return body, nil
+	}
+	if c.Store == nil {
+		return "", fmt.Errorf("%w: payload is stored, but the codec has no store", ErrCallbackData)
+	}
+	payload, ok, err := c.Store.Load(body[1:])
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", fmt.Errorf("%w: payload %s not found", ErrCallbackData, body[1:])
+	}
+	return payload, nil
+}
+
+func (c *CallbackCodec) sign(data string) string {
+	if len(c.Secret) == 0 {
+		return data
+	}
+	mac := hmac.New(sha256.New, c.Secret)
+	mac.Write([]byte(data))
+	return data + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:6])
+}
+
+// callbackFields returns the encoded fields of a struct, or the value itself
+func callbackFields(v reflect.Value) []reflect.Value {
+	if v.Kind() != reflect.Struct {
+		return []reflect.Value{v}
+	}
+
+	var fields []reflect.Value
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		if f.PkgPath != "" || f.Tag.Get("callback") == "-" {
+			continue
+		}
+		fields = append(fields, v.Field(i))
+	}
+	return fields
+}
+
+func encodeCallbackValue(v reflect.Value) (string, error) {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return "", fmt.Errorf("%w: nil value", ErrCallbackData)
+		}
+		v = v.Elem()
+	}
+
+	fields := callbackFields(v)
+	parts := make([]string, len(fields))
+	for i, f := range fields {
+		switch f.Kind() {
+		case reflect.String:
+			parts[i] = callbackEscaper.Replace(f.String())
+		case reflect.Bool:
+			if f.Bool() {
+				parts[i] = "1"
+			}
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			parts[i] = strconv.FormatInt(f.Int(), 36)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			parts[i] = strconv.FormatUint(f.Uint(), 36)
+		case reflect.Float32, reflect.Float64:
+			parts[i] = strconv.FormatFloat(f.Float(), 'g', -1, 64)
+		default:
+			return "", fmt.Errorf("%w: unsupported type %s", ErrCallbackData, f.Type())
+		}
+	}
+	return strings.Join(parts, ","), nil
+}
+
+func decodeCallbackPayload(payload string, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("%w: decode target must be a non-nil pointer", ErrCallbackData)
+	}
+
+	fields := callbackFields(rv.Elem())
+	if len(fields) == 0 && payload == "" {
+		return nil
+	}
+	parts := splitCallbackPayload(payload)
+	if len(parts) != len(fields) {
+		return fmt.Errorf("%w: %d values for %d fields", ErrCallbackData, len(parts), len(fields))
+	}
+
+	for i, f := range fields {
+		var err error
+		switch f.Kind() {
+		case reflect.String:
+			f.SetString(parts[i])
+		case reflect.Bool:
+			f.SetBool(parts[i] == "1")
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			var n int64
+			if n, err = strconv.ParseInt(parts[i], 36, f.Type().Bits()); err == nil {
+				f.SetInt(n)
+			}
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			var n uint64
+			if n, err = strconv.ParseUint(parts[i], 36, f.Type().Bits()); err == nil {
+				f.SetUint(n)
+			}
+		case reflect.Float32, reflect.Float64:
+			var n float64
+			if n, err = strconv.ParseFloat(parts[i], f.Type().Bits()); err == nil {
+				f.SetFloat(n)
+			}
+		default:
+			err = fmt.Errorf("unsupported type %s", f.Type())
+		}
+		if err != nil {
+			return fmt.Errorf("%w: field %d: %v", ErrCallbackData, i, err)
+		}
+	}
+	return nil
+}
+
+var callbackEscaper = strings.NewReplacer(`\`, `\\`, `,`, `\,`, `#`, `\#`)
+
+// splitCallbackPayload splits the payload by unescaped commas and unescapes the parts
+func splitCallbackPayload(payload string) []string {
+	var parts []string
+	var part strings.Builder
+	for i := 0; i < len(payload); i++ {
+		switch {
+		case payload[i] == '\\' && i+1 < len(payload):
+			i++
+			part.WriteByte(payload[i])
+		case payload[i] == ',':
+			parts = append(parts, part.String())
+			part.Reset()
+		default:
+			part.WriteByte(payload[i])
+		}
+	}
+	return append(parts, part.String())
+}
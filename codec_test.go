@@ -0,0 +1,106 @@
+package telestage
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testOrder struct {
+	ID     int64
+	Action string
+	Paid   bool
+	Price  float64
+	Note   string `callback:"-"`
+	secret string
+}
+
+func TestCallbackCodec_Encode(t *testing.T) {
+	c := NewCallbackCodec(nil, nil)
+
+	data, err := c.Encode("order", testOrder{ID: 1000, Action: "a,b#\\", Paid: true, Price: 1.5, Note: "skipped"})
+	require.NoError(t, err)
+	assert.Equal(t, `order:rs,a\,b\#\\,1,1.5`, data)
+
+	var o testOrder
+	require.NoError(t, c.Decode(data, &o))
+	assert.Equal(t, testOrder{ID: 1000, Action: "a,b#\\", Paid: true, Price: 1.5}, o)
+
+	data, err = c.Encode("page", 3)
+	require.NoError(t, err)
+	var page int
+	require.NoError(t, c.Decode(data, &page))
+	assert.Equal(t, 3, page)
+
+	_, err = c.Encode("bad", struct{ Tags []string }{})
+	assert.True(t, errors.Is(err, ErrCallbackData))
+}
+
+func TestCallbackCodec_Signed(t *testing.T) {
+	c := NewCallbackCodec([]byte("secret"), nil)
+
+	data, err := c.Encode("order", testOrder{ID: 1})
+	require.NoError(t, err)
+
+	var o testOrder
+	require.NoError(t, c.Decode(data, &o))
+	assert.Equal(t, int64(1), o.ID)
+
+	tampered := strings.Replace(data, "order:1", "order:2", 1)
+	assert.True(t, errors.Is(c.Decode(tampered, &o), ErrCallbackData), "tampered data must be rejected")
+	assert.True(t, errors.Is(NewCallbackCodec([]byte("other"), nil).Decode(data, &o), ErrCallbackData))
+}
+
+func TestCallbackCodec_Store(t *testing.T) {
+	long := testOrder{Action: strings.Repeat("x", MaxCallbackData)}
+
+	_, err := NewCallbackCodec(nil, nil).Encode("order", long)
+	assert.True(t, errors.Is(err, ErrCallbackData), "too long data without a store")
+
+	c := NewCallbackCodec([]byte("secret"), NewMemoryCallbackStore())
+	data, err := c.Encode("order", long)
+	require.NoError(t, err)
+	assert.LessOrEqual(t, len(data), MaxCallbackData)
+	assert.True(t, strings.HasPrefix(data, "order:#"))
+
+	var o testOrder
+	require.NoError(t, c.Decode(data, &o))
+	assert.Equal(t, long.Action, o.Action)
+
+	other := NewCallbackCodec([]byte("secret"), NewMemoryCallbackStore())
+	assert.True(t, errors.Is(other.Decode(data, &o), ErrCallbackData), "unknown payload ID")
+}
+
+func TestCallbackCodec_Route(t *testing.T) {
+	c := NewCallbackCodec([]byte("secret"), nil)
+	route := c.Route("order")
+
+	markup, err := NewInlineKeyboard().Callback("Pay", route, testOrder{ID: 7, Action: "pay"}).Build()
+	require.NoError(t, err)
+	data := *markup.InlineKeyboard[0][0].CallbackData
+
+	var got testOrder
+	s := NewScene()
+	s.OnCallback(route, func(ctx Context) {
+		require.NoError(t, route.Decode(ctx, &got))
+	})
+	stage := NewStage(emptyStateGetter)
+	stage.Add("", s)
+
+	stage.Run(&tgbotapi.BotAPI{}, tgbotapi.Update{
+		CallbackQuery: &tgbotapi.CallbackQuery{Data: data[:len(data)-1] + "A"},
+	})
+	assert.Equal(t, testOrder{}, got, "route must not match tampered data")
+
+	stage.Run(&tgbotapi.BotAPI{}, tgbotapi.Update{
+		CallbackQuery: &tgbotapi.CallbackQuery{Data: data},
+	})
+	assert.Equal(t, testOrder{ID: 7, Action: "pay"}, got)
+
+	_, err = route.Data(1, 2)
+	assert.True(t, errors.Is(err, ErrCallbackData))
+}
@@ -0,0 +1,191 @@
+package telestage
+
+import (
+	"fmt"
+	"sort"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// CommandList is the list of commands of a scope and language, as set by setMyCommands.
+type CommandList struct {
+	Scope tgbotapi.BotCommandScope
+	// Language is the language code, empty for users without a dedicated list.
+	Language string
+	Commands []tgbotapi.BotCommand
+}
+
+// Commands returns the command lists of the described commands of all
+// scenes, by scope and language. A command registered in several scenes is
+// listed once, with the description of the first scene by state.
+func (s *Stage) Commands() []CommandList {
+	var routes []*Route
+	for _, state := range s.Scenes() {
+		routes = append(routes, s.scenes[state].Routes()...)
+	}
+	return commandLists(routes, nil)
+}
+
+// commandLists groups the described commands of the routes by scope and
+// language, the scope of all commands is overridden if set
+func commandLists(routes []*Route, scope *tgbotapi.BotCommandScope) []CommandList {
+	type key struct {
+		scope tgbotapi.BotCommandScope
+		// the command or the language
+		value string
+	}
+	var scopes []tgbotapi.BotCommandScope
+	byScope := map[tgbotapi.BotCommandScope][]*Route{}
+	langs := map[tgbotapi.BotCommandScope][]string{}
+	listed := map[key]bool{}
+	hasLang := map[key]bool{}
+
+	for _, r := range routes {
+		if r.command == "" || len(r.descriptions) == 0 {
+			continue
+		}
+		rs := r.Scopes()
+		if scope != nil {
+			rs = []tgbotapi.BotCommandScope{*scope}
+		}
+		for _, sc := range rs {
+			if listed[key{sc, r.command}] {
+				continue
+			}
+			listed[key{sc, r.command}] = true
+			if _, ok := byScope[sc]; !ok {
+				scopes = append(scopes, sc)
+			}
+			byScope[sc] = append(byScope[sc], r)
+			for lang := range r.descriptions {
+				if lang != "" && !hasLang[key{sc, lang}] {
+					hasLang[key{sc, lang}] = true
+					langs[sc] = append(langs[sc], lang)
+				}
+			}
+		}
+	}
+
+	var lists []CommandList
+	for _, sc := range scopes {
+		sort.Strings(langs[sc])
+		for _, lang := range append([]string{""}, langs[sc]...) {
+			list := CommandList{Scope: sc, Language: lang}
+			for _, r := range byScope[sc] {
+				if d := r.Description(lang); d != "" {
+					list.Commands = append(list.Commands, tgbotapi.BotCommand{Command: r.command, Description: d})
+				}
+			}
+			if len(list.Commands) > 0 {
+				lists = append(lists, list)
+			}
+		}
+	}
+	return lists
+}
+
+// SyncCommands sets the commands of all scenes for their scopes and languages with setMyCommands.
+func (s *Stage) SyncCommands(bot *tgbotapi.BotAPI) error {
+	return setCommands(bot, s.Commands())
+}
+
+func setCommands(bot *tgbotapi.BotAPI, lists []CommandList) error {
+	for _, l := range lists {
+		if _, err := bot.Request(tgbotapi.NewSetMyCommandsWithScopeAndLanguage(l.Scope, l.Language, l.Commands...)); err != nil {
+			return fmt.Errorf("set commands of scope %s: %w", l.Scope.Type, err)
+		}
+	}
+	return nil
+}
+
+// SetChatCommands sets the commands of the scene with the state for the
+// sender of the update: in private chats for the chat, in groups for the
+// member of the chat.
+func (s *Stage) SetChatCommands(ctx Context, state string) error {
+	scene, ok := s.scenes[state]
+	if !ok {
+		return fmt.Errorf("%w with name %s", ErrSceneNotFound, state)
+	}
+	c, u := ctx.Chat(), ctx.Sender()
+	if c == nil || u == nil {
+		return nil
+	}
+
+	scope := tgbotapi.NewBotCommandScopeChat(c.ID)
+	if !c.IsPrivate() {
+		scope = tgbotapi.NewBotCommandScopeChatMember(c.ID, u.ID)
+	}
+	lists := commandLists(scene.Routes(), &scope)
+	if len(lists) == 0 {
+		_, err := ctx.Bot().Request(tgbotapi.DeleteMyCommandsConfig{Scope: &scope})
+		return err
+	}
+	return setCommands(ctx.Bot(), lists)
+}
+
+// SyncSceneCommands makes the stage set the commands of the scene for the
+// sender with SetChatCommands when the state changes, e.g. when a handler
+// moves the user to another scene. The state is remembered in memory, so
+// the commands are set again for the first update after a restart.
+// Failures don't fail the update, they are passed to the handler set with
+// SetCommandsErrorHandler.
+func (s *Stage) SyncSceneCommands(enabled bool) {
+	s.commandsLock.Lock()
+	defer s.commandsLock.Unlock()
+
+	s.syncSceneCommands = enabled
+	s.commandScenes = map[commandsKey]string{}
+}
+
+// SetCommandsErrorHandler sets the handler of the errors of syncing the
+// commands of scenes, they are ignored by default.
+func (s *Stage) SetCommandsErrorHandler(h func(Context, error)) {
+	s.commandsLock.Lock()
+	defer s.commandsLock.Unlock()
+
+	s.commandsErrorHandler = h
+}
+
+type commandsKey struct {
+	chatID, userID int64
+}
+
+// syncCommands sets the commands of the scene of the sender when
+// SyncSceneCommands is enabled, reporting failures to the error handler
+func (s *Stage) syncCommands(ctx Context) {
+	s.commandsLock.Lock()
+	enabled, onError := s.syncSceneCommands, s.commandsErrorHandler
+	s.commandsLock.Unlock()
+	if !enabled {
+		return
+	}
+
+	if err := s.syncChatCommands(ctx); err != nil && onError != nil {
+		onError(ctx, err)
+	}
+}
+
+// syncChatCommands sets the commands of the scene of the sender if the state changed since the last update
+func (s *Stage) syncChatCommands(ctx Context) error {
+	c, u := ctx.Chat(), ctx.Sender()
+	if c == nil || u == nil {
+		return nil
+	}
+	state := s.stateGetter(ctx)
+	key := commandsKey{c.ID, u.ID}
+
+	s.commandsLock.Lock()
+	synced, ok := s.commandScenes[key]
+	s.commandsLock.Unlock()
+	if ok && synced == state {
+		return nil
+	}
+
+	if err := s.SetChatCommands(ctx, state); err != nil {
+		return fmt.Errorf("set commands of scene %s: %w", state, err)
+	}
+	s.commandsLock.Lock()
+	s.commandScenes[key] = state
+	s.commandsLock.Unlock()
+	return nil
+}
@@ -0,0 +1,108 @@
+package telestage
+
+import (
+	"encoding/json"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoute_Description(t *testing.T) {
+	r := NewScene().OnCommand("start", func(Context) {}).
+		Describe("Start the bot").
+		DescribeIn("uk", "Запустити бота")
+
+	assert.Equal(t, "command:start", r.Name())
+	assert.Equal(t, "start", r.Command())
+	assert.Equal(t, "Start the bot", r.Description(""))
+	assert.Equal(t, "Start the bot", r.Description("de"))
+	assert.Equal(t, "Запустити бота", r.Description("uk-UA"))
+	assert.Equal(t, []tgbotapi.BotCommandScope{tgbotapi.NewBotCommandScopeDefault()}, r.Scopes())
+}
+
+func TestStage_Commands(t *testing.T) {
+	main := NewScene()
+	main.OnStart(func(Context) {}).Describe("Start").DescribeIn("uk", "Старт")
+	main.OnCommand("help", func(Context) {}).Describe("Help")
+	main.OnCommand("hidden", func(Context) {})
+	main.OnMessage(func(Context) {})
+
+	admin := NewScene()
+	admin.OnCommand("ban", func(Context) {}).Describe("Ban a user").
+		Scope(tgbotapi.NewBotCommandScopeAllChatAdministrators(), tgbotapi.NewBotCommandScopeChat(42))
+	admin.OnCommand("help", func(Context) {}).Describe("Admin help")
+
+	stage := NewStage(func(Context) string { return "main" })
+	stage.Add("main", main)
+	stage.Add("admin", admin)
+
+	defaultScope := tgbotapi.NewBotCommandScopeDefault()
+	assert.Equal(t, []CommandList{
+		{Scope: tgbotapi.NewBotCommandScopeAllChatAdministrators(), Commands: []tgbotapi.BotCommand{{Command: "ban", Description: "Ban a user"}}},
+		{Scope: tgbotapi.NewBotCommandScopeChat(42), Commands: []tgbotapi.BotCommand{{Command: "ban", Description: "Ban a user"}}},
+		{Scope: defaultScope, Commands: []tgbotapi.BotCommand{{Command: "help", Description: "Admin help"}, {Command: "start", Description: "Start"}}},
+		{Scope: defaultScope, Language: "uk", Commands: []tgbotapi.BotCommand{{Command: "help", Description: "Admin help"}, {Command: "start", Description: "Старт"}}},
+	}, stage.Commands())
+
+	srv, bot := newTestBot(t)
+	require.NoError(t, stage.SyncCommands(bot))
+	calls := srv.CallsTo("setMyCommands")
+	require.Len(t, calls, 4)
+	assert.JSONEq(t, `{"type":"chat","chat_id":42}`, calls[1].Params.Get("scope"))
+	assert.Equal(t, "uk", calls[3].Params.Get("language_code"))
+	var commands []tgbotapi.BotCommand
+	require.NoError(t, json.Unmarshal([]byte(calls[3].Params.Get("commands")), &commands))
+	assert.Len(t, commands, 2)
+}
+
+func TestStage_SyncSceneCommands(t *testing.T) {
+	srv, bot := newTestBot(t)
+
+	states := map[int64]string{}
+	main := NewScene()
+	main.OnCommand("settings", func(ctx Context) {
+		states[ctx.Sender().ID] = "settings"
+	}).Describe("Settings")
+	settings := NewScene()
+	settings.OnCommand("back", func(ctx Context) {
+		states[ctx.Sender().ID] = "main"
+	}).Describe("Back")
+	settings.OnMessage(func(Context) {})
+
+	stage := NewStage(func(ctx Context) string {
+		if s, ok := states[ctx.Sender().ID]; ok {
+			return s
+		}
+		return "main"
+	})
+	stage.Add("main", main)
+	stage.Add("settings", settings)
+	stage.SyncSceneCommands(true)
+
+	command := func(text string) tgbotapi.Update {
+		upd := userMessage(1, 1, text)
+		upd.Message.Entities = []tgbotapi.MessageEntity{{Type: "bot_command", Length: len(text)}}
+		return upd
+	}
+	require.NoError(t, stage.Run(bot, command("/settings")))
+	require.NoError(t, stage.Run(bot, userMessage(1, 2, "hi")))
+	require.NoError(t, stage.Run(bot, command("/back")))
+
+	calls := srv.CallsTo("setMyCommands")
+	require.Len(t, calls, 2, "set on entering a scene only")
+	assert.JSONEq(t, `{"type":"chat","chat_id":1}`, calls[0].Params.Get("scope"))
+	assert.JSONEq(t, `[{"command":"back","description":"Back"}]`, calls[0].Params.Get("commands"))
+	assert.JSONEq(t, `[{"command":"settings","description":"Settings"}]`, calls[1].Params.Get("commands"))
+
+	var errs []error
+	stage.SetCommandsErrorHandler(func(_ Context, err error) {
+		errs = append(errs, err)
+	})
+	srv.FailNext("setMyCommands", 400, "Bad Request: chat not found", 0)
+	states[2] = "settings"
+	assert.NoError(t, stage.Run(bot, userMessage(2, 3, "hi")), "handled update must not fail")
+	require.Len(t, errs, 1)
+	assert.Contains(t, errs[0].Error(), "set commands of scene settings")
+}
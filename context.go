@@ -1,6 +1,7 @@
 package telestage
 
 import (
+	"encoding/json"
 	"sync"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
@@ -16,11 +17,39 @@ type Context interface {
 	Text() string
 	// Fast methods
 
+	// Send sends the text to the chat with the stage default options overridden by opts.
+	Send(text string, opts ...SendOption) (tgbotapi.Message, error)
+	// Deprecated: use Stage.SetDefaultSendOptions(WithPreview(false)) or WithPreview.
 	SetDisableWebPreviewForShortMethods(bool)
-	Reply(string) (tgbotapi.Message, error)
-	ReplyWithMenu(string, interface{}) (tgbotapi.Message, error)
-	ReplyHTML(string) (tgbotapi.Message, error)
-	ReplyWithMenuHTML(string, interface{}) (tgbotapi.Message, error)
+	Reply(string, ...SendOption) (tgbotapi.Message, error)
+	ReplyWithMenu(string, interface{}, ...SendOption) (tgbotapi.Message, error)
+	ReplyHTML(string, ...SendOption) (tgbotapi.Message, error)
+	ReplyWithMenuHTML(string, interface{}, ...SendOption) (tgbotapi.Message, error)
+	ReplyMarkdown(string, ...SendOption) (tgbotapi.Message, error)
+	ReplyWithMenuMarkdown(string, interface{}, ...SendOption) (tgbotapi.Message, error)
+	// ReplyTo replies quoting the message of the update.
+	ReplyTo(string, ...SendOption) (tgbotapi.Message, error)
+	ReplyPhoto(photo tgbotapi.RequestFileData, caption string, opts ...SendOption) (tgbotapi.Message, error)
+	ReplyDocument(document tgbotapi.RequestFileData, caption string, opts ...SendOption) (tgbotapi.Message, error)
+	// ReplyMediaGroup sends an album of tgbotapi.InputMedia* items.
+	ReplyMediaGroup(media []interface{}, opts ...SendOption) ([]tgbotapi.Message, error)
+	// Edit changes the text of the message of the update, e.g. the message
+	// with the inline keyboard the callback query came from.
+	Edit(string, ...SendOption) (tgbotapi.Message, error)
+	// EditMarkup changes the inline keyboard of the message of the update.
+	EditMarkup(tgbotapi.InlineKeyboardMarkup) (tgbotapi.Message, error)
+	// Delete deletes the message of the update.
+	Delete() error
+	// Forward forwards the message of the update to the chat.
+	Forward(chatID int64, opts ...SendOption) (tgbotapi.Message, error)
+	// Copy copies the message of the update to the chat without a link to the original.
+	Copy(chatID int64, opts ...SendOption) (tgbotapi.MessageID, error)
+	// SendChatAction shows an action like tgbotapi.ChatTyping in the chat.
+	SendChatAction(action string) error
+
+	// T translates the message with the key to the locale resolved by I18n.Middleware,
+	// the key is returned as is without it.
+	T(key string, args ...Args) string
 
 	// Get retrieves data from the context.
 	Get(key string) interface{}
@@ -34,6 +63,8 @@ type NativeContext struct {
 	lock  sync.RWMutex
 	store map[string]interface{}
 
+	// defaults are the send options of the stage
+	defaults          []SendOption
 	disableWebPreview bool
 }
 
@@ -127,53 +158,244 @@ func (nc *NativeContext) Text() string {
 	return m.Text
 }
 
-func (nc *NativeContext) Reply(text string) (tgbotapi.Message, error) {
-	m := tgbotapi.NewMessage(nc.ChatID(), text)
-	m.DisableWebPagePreview = nc.disableWebPreview
-	return nc.bot.Send(tgbotapi.NewMessage(nc.ChatID(), text))
+func (nc *NativeContext) Send(text string, opts ...SendOption) (tgbotapi.Message, error) {
+	o := nc.options(opts)
+	params := tgbotapi.Params{"text": text}
+	params.AddNonZero64("chat_id", nc.ChatID())
+	params.AddBool("disable_web_page_preview", o.DisableWebPagePreview)
+	if err := o.addTo(params); err != nil {
+		return tgbotapi.Message{}, err
+	}
+
+	return nc.sendMessage("sendMessage", params)
 }
 
-func (nc *NativeContext) ReplyWithMenu(text string, menu interface{}) (tgbotapi.Message, error) {
-	return nc.bot.Send(tgbotapi.MessageConfig{
-		BaseChat: tgbotapi.BaseChat{
-			ChatID:           nc.ChatID(),
-			ReplyToMessageID: 0,
-			ReplyMarkup:      menu,
-		},
-		Text:                  text,
-		DisableWebPagePreview: nc.disableWebPreview,
-	})
+func (nc *NativeContext) Reply(text string, opts ...SendOption) (tgbotapi.Message, error) {
+	return nc.Send(text, opts...)
 }
 
-func (nc *NativeContext) ReplyHTML(text string) (tgbotapi.Message, error) {
-	return nc.bot.Send(tgbotapi.MessageConfig{
-		BaseChat: tgbotapi.BaseChat{
-			ChatID:           nc.ChatID(),
-			ReplyToMessageID: 0,
-		},
-		Text:                  text,
-		ParseMode:             tgbotapi.ModeHTML,
-		DisableWebPagePreview: nc.disableWebPreview,
-	})
+func (nc *NativeContext) ReplyWithMenu(text string, menu interface{}, opts ...SendOption) (tgbotapi.Message, error) {
+	return nc.Send(text, append([]SendOption{WithMarkup(menu)}, opts...)...)
+}
+
+func (nc *NativeContext) ReplyHTML(text string, opts ...SendOption) (tgbotapi.Message, error) {
+	return nc.Send(text, append([]SendOption{WithParseMode(tgbotapi.ModeHTML)}, opts...)...)
+}
+
+func (nc *NativeContext) ReplyWithMenuHTML(text string, menu interface{}, opts ...SendOption) (tgbotapi.Message, error) {
+	return nc.Send(text, append([]SendOption{WithParseMode(tgbotapi.ModeHTML), WithMarkup(menu)}, opts...)...)
+}
+
+func (nc *NativeContext) ReplyMarkdown(text string, opts ...SendOption) (tgbotapi.Message, error) {
+	return nc.Send(text, append([]SendOption{WithParseMode(tgbotapi.ModeMarkdownV2)}, opts...)...)
+}
+
+func (nc *NativeContext) ReplyWithMenuMarkdown(text string, menu interface{}, opts ...SendOption) (tgbotapi.Message, error) {
+	return nc.Send(text, append([]SendOption{WithParseMode(tgbotapi.ModeMarkdownV2), WithMarkup(menu)}, opts...)...)
+}
+
+func (nc *NativeContext) ReplyTo(text string, opts ...SendOption) (tgbotapi.Message, error) {
+	return nc.Send(text, append([]SendOption{WithReplyTo(nc.messageID())}, opts...)...)
+}
+
+func (nc *NativeContext) ReplyPhoto(photo tgbotapi.RequestFileData, caption string, opts ...SendOption) (tgbotapi.Message, error) {
+	return nc.sendFile("sendPhoto", "photo", photo, caption, opts)
+}
+
+func (nc *NativeContext) ReplyDocument(document tgbotapi.RequestFileData, caption string, opts ...SendOption) (tgbotapi.Message, error) {
+	return nc.sendFile("sendDocument", "document", document, caption, opts)
+}
+
+func (nc *NativeContext) ReplyMediaGroup(media []interface{}, opts ...SendOption) ([]tgbotapi.Message, error) {
+	o := nc.options(opts)
+	media, files := prepareMediaGroup(media, o.ParseMode)
+	// albums have neither a parse mode of their own nor a keyboard
+	o.ParseMode, o.ReplyMarkup = "", nil
+
+	params := tgbotapi.Params{}
+	params.AddNonZero64("chat_id", nc.ChatID())
+	if err := params.AddInterface("media", media); err != nil {
+		return nil, err
+	}
+	if err := o.addTo(params); err != nil {
+		return nil, err
+	}
+
+	var messages []tgbotapi.Message
+	resp, err := nc.request("sendMediaGroup", params, files)
+	if err != nil {
+		return messages, err
+	}
+	err = json.Unmarshal(resp.Result, &messages)
+	return messages, err
+}
+
+func (nc *NativeContext) Edit(text string, opts ...SendOption) (tgbotapi.Message, error) {
+	o := nc.options(opts)
+	target := nc.editTarget()
+	params := tgbotapi.Params{"text": text}
+	params.AddNonZero64("chat_id", target.ChatID)
+	params.AddNonZero("message_id", target.MessageID)
+	params.AddNonEmpty("inline_message_id", target.InlineMessageID)
+	params.AddNonEmpty("parse_mode", o.ParseMode)
+	params.AddBool("disable_web_page_preview", o.DisableWebPagePreview)
+	if err := params.AddInterface("reply_markup", o.ReplyMarkup); err != nil {
+		return tgbotapi.Message{}, err
+	}
+
+	var m tgbotapi.Message
+	resp, err := nc.request("editMessageText", params, nil)
+	if err != nil {
+		return m, err
+	}
+	return m, decodeEdited(resp, &m)
 }
 
-func (nc *NativeContext) ReplyWithMenuHTML(text string, menu interface{}) (tgbotapi.Message, error) {
-	return nc.bot.Send(tgbotapi.MessageConfig{
-		BaseChat: tgbotapi.BaseChat{
-			ChatID:           nc.ChatID(),
-			ReplyToMessageID: 0,
-			ReplyMarkup:      menu,
-		},
-		Text:                  text,
-		ParseMode:             tgbotapi.ModeHTML,
-		DisableWebPagePreview: nc.disableWebPreview,
+func (nc *NativeContext) EditMarkup(markup tgbotapi.InlineKeyboardMarkup) (tgbotapi.Message, error) {
+	target := nc.editTarget()
+	target.ReplyMarkup = &markup
+	return nc.edit(tgbotapi.EditMessageReplyMarkupConfig{
+		BaseEdit: target,
 	})
 }
 
+func (nc *NativeContext) Delete() error {
+	_, err := nc.bot.Request(tgbotapi.NewDeleteMessage(nc.ChatID(), nc.messageID()))
+	return err
+}
+
+func (nc *NativeContext) Forward(chatID int64, opts ...SendOption) (tgbotapi.Message, error) {
+	o := nc.options(opts)
+	params := tgbotapi.Params{}
+	params.AddNonZero64("chat_id", chatID)
+	params.AddNonZero64("from_chat_id", nc.ChatID())
+	params.AddNonZero("message_id", nc.messageID())
+	// a forward keeps the content of the original as is
+	if err := (SendOptions{
+		MessageThreadID:     o.MessageThreadID,
+		DisableNotification: o.DisableNotification,
+		ProtectContent:      o.ProtectContent,
+	}).addTo(params); err != nil {
+		return tgbotapi.Message{}, err
+	}
+
+	return nc.sendMessage("forwardMessage", params)
+}
+
+func (nc *NativeContext) Copy(chatID int64, opts ...SendOption) (tgbotapi.MessageID, error) {
+	params := tgbotapi.Params{}
+	params.AddNonZero64("chat_id", chatID)
+	params.AddNonZero64("from_chat_id", nc.ChatID())
+	params.AddNonZero("message_id", nc.messageID())
+	if err := nc.options(opts).addTo(params); err != nil {
+		return tgbotapi.MessageID{}, err
+	}
+
+	var id tgbotapi.MessageID
+	resp, err := nc.request("copyMessage", params, nil)
+	if err != nil {
+		return id, err
+	}
+	err = json.Unmarshal(resp.Result, &id)
+	return id, err
+}
+
+func (nc *NativeContext) SendChatAction(action string) error {
+	_, err := nc.bot.Request(tgbotapi.NewChatAction(nc.ChatID(), action))
+	return err
+}
+
+func (nc *NativeContext) messageID() int {
+	if m := nc.Message(); m != nil {
+		return m.MessageID
+	}
+	return 0
+}
+
+// editTarget returns the message to edit: the inline message of the callback query or the message of the update
+func (nc *NativeContext) editTarget() tgbotapi.BaseEdit {
+	if q := nc.upd.CallbackQuery; q != nil && q.InlineMessageID != "" {
+		return tgbotapi.BaseEdit{InlineMessageID: q.InlineMessageID}
+	}
+	return tgbotapi.BaseEdit{
+		ChatID:    nc.ChatID(),
+		MessageID: nc.messageID(),
+	}
+}
+
+// edit sends the edit request
+func (nc *NativeContext) edit(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	var m tgbotapi.Message
+	resp, err := nc.bot.Request(c)
+	if err != nil {
+		return m, err
+	}
+	return m, decodeEdited(resp, &m)
+}
+
+// decodeEdited decodes the edited message, the API returns true instead of it when an inline message is edited
+func decodeEdited(resp *tgbotapi.APIResponse, m *tgbotapi.Message) error {
+	if len(resp.Result) > 0 && resp.Result[0] == '{' {
+		return json.Unmarshal(resp.Result, m)
+	}
+	return nil
+}
+
+// options returns the options of an outgoing message: the stage defaults overridden by opts
+func (nc *NativeContext) options(opts []SendOption) SendOptions {
+	o := newSendOptions(nc.defaults, opts)
+	if nc.disableWebPreview {
+		o.DisableWebPagePreview = true
+	}
+	return o
+}
+
+func (nc *NativeContext) sendFile(method, field string, file tgbotapi.RequestFileData, caption string, opts []SendOption) (tgbotapi.Message, error) {
+	params := tgbotapi.Params{}
+	params.AddNonZero64("chat_id", nc.ChatID())
+	params.AddNonEmpty("caption", caption)
+	if err := nc.options(opts).addTo(params); err != nil {
+		return tgbotapi.Message{}, err
+	}
+
+	return nc.sendMessage(method, params, tgbotapi.RequestFile{Name: field, Data: file})
+}
+
+func (nc *NativeContext) sendMessage(method string, params tgbotapi.Params, files ...tgbotapi.RequestFile) (tgbotapi.Message, error) {
+	var m tgbotapi.Message
+	resp, err := nc.request(method, params, files)
+	if err != nil {
+		return m, err
+	}
+	err = json.Unmarshal(resp.Result, &m)
+	return m, err
+}
+
+// request calls the method, uploading the files with multipart/form-data when any of them is local
+func (nc *NativeContext) request(method string, params tgbotapi.Params, files []tgbotapi.RequestFile) (*tgbotapi.APIResponse, error) {
+	for _, f := range files {
+		if f.Data.NeedsUpload() {
+			return nc.bot.UploadFiles(method, params, files)
+		}
+	}
+	for _, f := range files {
+		params[f.Name] = f.Data.SendData()
+	}
+	return nc.bot.MakeRequest(method, params)
+}
+
 func (nc *NativeContext) SetDisableWebPreviewForShortMethods(isDisabled bool) {
 	nc.disableWebPreview = isDisabled
 }
 
+func (nc *NativeContext) T(key string, args ...Args) string {
+	i, _ := nc.Get(i18nKey).(*I18n)
+	if i == nil {
+		return key
+	}
+	return i.Translate(Locale(nc), key, args...)
+}
+
 func (nc *NativeContext) Set(key string, value interface{}) {
 	nc.lock.Lock()
 	defer nc.lock.Unlock()
@@ -189,3 +411,39 @@ func (nc *NativeContext) Get(key string) interface{} {
 	defer nc.lock.RUnlock()
 	return nc.store[key]
 }
+
+// UpdateType returns the type of the update as named by the Bot API, e.g. "message" or "callback_query".
+func UpdateType(upd *tgbotapi.Update) string {
+	switch {
+	case upd.Message != nil:
+		return "message"
+	case upd.EditedMessage != nil:
+		return "edited_message"
+	case upd.ChannelPost != nil:
+		return "channel_post"
+	case upd.EditedChannelPost != nil:
+		return "edited_channel_post"
+	case upd.InlineQuery != nil:
+		return "inline_query"
+	case upd.ChosenInlineResult != nil:
+		return "chosen_inline_result"
+	case upd.CallbackQuery != nil:
+		return "callback_query"
+	case upd.ShippingQuery != nil:
+		return "shipping_query"
+	case upd.PreCheckoutQuery != nil:
+		return "pre_checkout_query"
+	case upd.Poll != nil:
+		return "poll"
+	case upd.PollAnswer != nil:
+		return "poll_answer"
+	case upd.MyChatMember != nil:
+		return "my_chat_member"
+	case upd.ChatMember != nil:
+		return "chat_member"
+	case upd.ChatJoinRequest != nil:
+		return "chat_join_request"
+	default:
+		return "unknown"
+	}
+}
@@ -4,10 +4,51 @@ import (
 	"reflect"
 	"testing"
 
+	"github.com/askoldex/telestage/telestagetest"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
+func newTestBot(t *testing.T) (*telestagetest.Server, *tgbotapi.BotAPI) {
+	srv := telestagetest.NewServer()
+	t.Cleanup(srv.Close)
+
+	bot, err := srv.Bot()
+	require.NoError(t, err)
+
+	return srv, bot
+}
+
+// newTestContext returns a context of the update, which is also known to the fake server
+func newTestContext(t *testing.T, upd tgbotapi.Update) (*telestagetest.Server, *NativeContext) {
+	srv, bot := newTestBot(t)
+	srv.PushUpdate(upd)
+
+	return srv, &NativeContext{bot: bot, upd: &upd}
+}
+
+func userMessage(chatID int64, messageID int, text string) tgbotapi.Update {
+	return tgbotapi.Update{
+		Message: &tgbotapi.Message{
+			MessageID: messageID,
+			From:      &tgbotapi.User{ID: chatID},
+			Chat:      &tgbotapi.Chat{ID: chatID, Type: "private"},
+			Text:      text,
+		},
+	}
+}
+
+func groupMessage(chatID, userID int64, text string) *NativeContext {
+	return &NativeContext{upd: &tgbotapi.Update{
+		Message: &tgbotapi.Message{
+			From: &tgbotapi.User{ID: userID},
+			Chat: &tgbotapi.Chat{ID: chatID, Type: "supergroup"},
+			Text: text,
+		},
+	}}
+}
+
 func TestNativeContext_Bot(t *testing.T) {
 	b := &tgbotapi.BotAPI{}
 	nc := &NativeContext{bot: b}
@@ -332,3 +373,193 @@ func TestNativeContext_Text(t *testing.T) {
 		})
 	}
 }
+
+func TestNativeContext_ReplyMarkdown(t *testing.T) {
+	srv, nc := newTestContext(t, userMessage(1, 10, "hi"))
+
+	_, err := nc.ReplyMarkdown("*bold*")
+	require.NoError(t, err)
+	_, err = nc.ReplyWithMenuMarkdown("_menu_", tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("a", "a")),
+	))
+	require.NoError(t, err)
+
+	calls := srv.CallsTo("sendMessage")
+	require.Len(t, calls, 2)
+	assert.Equal(t, tgbotapi.ModeMarkdownV2, calls[0].Params.Get("parse_mode"))
+	assert.Equal(t, tgbotapi.ModeMarkdownV2, calls[1].Params.Get("parse_mode"))
+	assert.NotEmpty(t, calls[1].Params.Get("reply_markup"))
+}
+
+func TestNativeContext_ReplyTo(t *testing.T) {
+	_, nc := newTestContext(t, userMessage(1, 10, "hi"))
+
+	m, err := nc.ReplyTo("quoted")
+	require.NoError(t, err)
+	require.NotNil(t, m.ReplyToMessage)
+	assert.Equal(t, 10, m.ReplyToMessage.MessageID)
+}
+
+func TestNativeContext_Edit(t *testing.T) {
+	srv, bot := newTestBot(t)
+	sent, err := bot.Send(tgbotapi.NewMessage(1, "menu"))
+	require.NoError(t, err)
+
+	nc := &NativeContext{bot: bot, upd: &tgbotapi.Update{
+		CallbackQuery: &tgbotapi.CallbackQuery{
+			From:    &tgbotapi.User{ID: 1},
+			Message: &sent,
+		},
+	}}
+
+	_, err = nc.Edit("edited")
+	require.NoError(t, err)
+	markup := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("b", "b")))
+	_, err = nc.EditMarkup(markup)
+	require.NoError(t, err)
+
+	m, ok := srv.Message(1, sent.MessageID)
+	require.True(t, ok)
+	assert.Equal(t, "edited", m.Text)
+	assert.Equal(t, &markup, m.ReplyMarkup)
+
+	require.NoError(t, nc.Delete())
+	_, ok = srv.Message(1, sent.MessageID)
+	assert.False(t, ok, "message must be deleted")
+}
+
+func TestNativeContext_EditInlineMessage(t *testing.T) {
+	srv, bot := newTestBot(t)
+	nc := &NativeContext{bot: bot, upd: &tgbotapi.Update{
+		CallbackQuery: &tgbotapi.CallbackQuery{
+			From:            &tgbotapi.User{ID: 1},
+			InlineMessageID: "inline",
+		},
+	}}
+
+	_, err := nc.Edit("edited")
+	require.NoError(t, err)
+
+	calls := srv.CallsTo("editMessageText")
+	require.Len(t, calls, 1)
+	assert.Equal(t, "inline", calls[0].Params.Get("inline_message_id"))
+}
+
+func TestNativeContext_ReplyMedia(t *testing.T) {
+	srv, nc := newTestContext(t, userMessage(1, 10, "hi"))
+
+	m, err := nc.ReplyPhoto(tgbotapi.FileBytes{Name: "cat.jpg", Bytes: []byte("jpeg")}, "cat")
+	require.NoError(t, err)
+	assert.Equal(t, "cat", m.Caption)
+
+	m, err = nc.ReplyDocument(tgbotapi.FileID("doc"), "doc")
+	require.NoError(t, err)
+	require.NotNil(t, m.Document)
+	assert.Equal(t, "doc", m.Document.FileID)
+
+	album, err := nc.ReplyMediaGroup([]interface{}{
+		tgbotapi.NewInputMediaPhoto(tgbotapi.FileID("a")),
+		tgbotapi.NewInputMediaPhoto(tgbotapi.FileBytes{Name: "b.jpg", Bytes: []byte("jpeg")}),
+	})
+	require.NoError(t, err)
+	assert.Len(t, album, 2)
+
+	assert.Len(t, srv.Calls(), 3)
+}
+
+func TestNativeContext_ForwardAndCopy(t *testing.T) {
+	srv, nc := newTestContext(t, userMessage(1, 10, "hi"))
+
+	m, err := nc.Forward(2)
+	require.NoError(t, err)
+	assert.Equal(t, "hi", m.Text)
+	assert.Equal(t, 10, m.ForwardFromMessageID)
+
+	_, err = nc.Copy(2)
+	require.NoError(t, err)
+
+	calls := srv.CallsTo("copyMessage")
+	require.Len(t, calls, 1)
+	assert.Equal(t, "2", calls[0].Params.Get("chat_id"))
+	assert.Equal(t, "1", calls[0].Params.Get("from_chat_id"))
+	assert.Equal(t, "10", calls[0].Params.Get("message_id"))
+}
+
+func TestNativeContext_SendChatAction(t *testing.T) {
+	srv, nc := newTestContext(t, userMessage(1, 10, "hi"))
+
+	require.NoError(t, nc.SendChatAction(tgbotapi.ChatTyping))
+
+	calls := srv.CallsTo("sendChatAction")
+	require.Len(t, calls, 1)
+	assert.Equal(t, tgbotapi.ChatTyping, calls[0].Params.Get("action"))
+}
+
+func TestNativeContext_Send(t *testing.T) {
+	srv, nc := newTestContext(t, userMessage(1, 10, "hi"))
+	nc.defaults = []SendOption{WithPreview(false), WithSilent(true)}
+
+	markup := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("a", "a")))
+	_, err := nc.Send("<b>hi</b>",
+		WithParseMode(tgbotapi.ModeHTML),
+		WithMarkup(markup),
+		WithReplyTo(10),
+		WithThreadID(7),
+		WithProtectContent(true),
+		WithSilent(false),
+	)
+	require.NoError(t, err)
+
+	calls := srv.CallsTo("sendMessage")
+	require.Len(t, calls, 1)
+	p := calls[0].Params
+	assert.Equal(t, tgbotapi.ModeHTML, p.Get("parse_mode"))
+	assert.Equal(t, "10", p.Get("reply_to_message_id"))
+	assert.Equal(t, "7", p.Get("message_thread_id"))
+	assert.Equal(t, "true", p.Get("protect_content"))
+	assert.Equal(t, "true", p.Get("disable_web_page_preview"), "default option must apply")
+	assert.Empty(t, p.Get("disable_notification"), "option must override the default")
+	assert.NotEmpty(t, p.Get("reply_markup"))
+}
+
+func TestNativeContext_ReplyDisableWebPreview(t *testing.T) {
+	srv, nc := newTestContext(t, userMessage(1, 10, "hi"))
+	nc.SetDisableWebPreviewForShortMethods(true)
+
+	_, err := nc.Reply("https://example.com")
+	require.NoError(t, err)
+
+	calls := srv.CallsTo("sendMessage")
+	require.Len(t, calls, 1)
+	assert.Equal(t, "true", calls[0].Params.Get("disable_web_page_preview"))
+}
+
+func TestNativeContext_SendOptionsMedia(t *testing.T) {
+	srv, nc := newTestContext(t, userMessage(1, 10, "hi"))
+
+	_, err := nc.ReplyPhoto(tgbotapi.FileBytes{Name: "cat.jpg", Bytes: []byte("jpeg")}, "<i>cat</i>",
+		WithParseMode(tgbotapi.ModeHTML), WithThreadID(7))
+	require.NoError(t, err)
+	_, err = nc.ReplyMediaGroup([]interface{}{
+		tgbotapi.NewInputMediaPhoto(tgbotapi.FileID("a")),
+		tgbotapi.NewInputMediaPhoto(tgbotapi.FileID("b")),
+	}, WithSilent(true), WithPreview(false))
+	require.NoError(t, err)
+	_, err = nc.Forward(2, WithProtectContent(true), WithParseMode(tgbotapi.ModeHTML))
+	require.NoError(t, err)
+
+	photo := srv.CallsTo("sendPhoto")
+	require.Len(t, photo, 1)
+	assert.Equal(t, tgbotapi.ModeHTML, photo[0].Params.Get("parse_mode"))
+	assert.Equal(t, "7", photo[0].Params.Get("message_thread_id"))
+
+	album := srv.CallsTo("sendMediaGroup")
+	require.Len(t, album, 1)
+	assert.Equal(t, "true", album[0].Params.Get("disable_notification"))
+	assert.Empty(t, album[0].Params.Get("disable_web_page_preview"), "preview applies to text only")
+
+	forward := srv.CallsTo("forwardMessage")
+	require.Len(t, forward, 1)
+	assert.Equal(t, "true", forward[0].Params.Get("protect_content"))
+	assert.Empty(t, forward[0].Params.Get("parse_mode"), "forward keeps the original formatting")
+}
@@ -0,0 +1,49 @@
+package telestage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCron_Invalid(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		_, err := ParseCron(spec)
+		assert.ErrorIs(t, err, ErrInvalidCron, spec)
+	}
+}
+
+func TestCronSchedule_Next(t *testing.T) {
+	// Wednesday
+	from := time.Date(2022, 11, 2, 10, 17, 30, 0, time.UTC)
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2022, 11, 2, 10, 18, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2022, 11, 2, 10, 30, 0, 0, time.UTC)},
+		{"0 9 * * *", time.Date(2022, 11, 3, 9, 0, 0, 0, time.UTC)},
+		{"30 9-18 * * 1-5", time.Date(2022, 11, 2, 10, 30, 0, 0, time.UTC)},
+		{"0 12 * * 6,0", time.Date(2022, 11, 5, 12, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2022, 11, 6, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2022, 12, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 13 * 5", time.Date(2022, 11, 4, 0, 0, 0, 0, time.UTC)}, // Friday or the 13th
+		{"@yearly", time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			s, err := ParseCron(tt.spec)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, s.Next(from))
+		})
+	}
+}
+
+func TestCronSchedule_NextNever(t *testing.T) {
+	s, err := ParseCron("0 0 31 2 *")
+	require.NoError(t, err)
+	assert.True(t, s.Next(time.Now()).IsZero(), "February 31 never happens")
+}
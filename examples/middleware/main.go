@@ -17,9 +17,11 @@ func main() {
 
 	mainScene.Use(func(ef telestage.EventFn) telestage.EventFn {
 		return func(ctx telestage.Context) {
-			if ctx.Message().Sticker == nil { // ignore if message is sticker
-				ef(ctx)
+			if ctx.Message().Sticker != nil { // ignore if message is sticker
+				telestage.Skip(ctx)
+				return
 			}
+			ef(ctx)
 		}
 	})
 
@@ -31,6 +33,7 @@ func main() {
 				ef(ctx)
 			} else {
 				ctx.Reply("This command available only in private chat")
+				telestage.Abort(ctx)
 			}
 		}
 	})
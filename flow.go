@@ -0,0 +1,63 @@
+package telestage
+
+const flowKey = "telestage.flow"
+
+type flow int
+
+const (
+	flowSkip flow = iota + 1
+	flowAbort
+)
+
+// Skip makes the scene try the next routes once the middleware or the
+// handler returns, as if the current route did not match. It is meant for
+// middleware declining the update, e.g. filters.
+//
+// Middleware which neither calls the next function nor calls Skip or Abort
+// leaves the update handled by the route.
+func Skip(ctx Context) {
+	ctx.Set(flowKey, flowSkip)
+}
+
+// Abort stops handling the update once the middleware or the handler
+// returns: no other route is tried and the after hooks are not run.
+func Abort(ctx Context) {
+	ctx.Set(flowKey, flowAbort)
+}
+
+// Aborted reports whether the handling of the update was aborted with Abort.
+func Aborted(ctx Context) bool {
+	f, _ := ctx.Get(flowKey).(flow)
+	return f == flowAbort
+}
+
+// skipped reports whether the current route was skipped with Skip
+func skipped(ctx Context) bool {
+	f, _ := ctx.Get(flowKey).(flow)
+	return f == flowSkip
+}
+
+// After adds hooks called after a route of the scene handled the update,
+// unless the route was skipped or aborted.
+func (s *Scene) After(hooks ...EventFn) {
+	s.after = append(s.after, hooks...)
+}
+
+// finish applies the flow chosen by the middleware or the handler of the
+// route, it reports whether the route handled the update
+func (s *Scene) finish(ctx Context) bool {
+	f, _ := ctx.Get(flowKey).(flow)
+	switch f {
+	case flowSkip:
+		ctx.Set(flowKey, nil)
+		ctx.Set(routeKey, nil)
+		return false
+	case flowAbort:
+		return true
+	}
+
+	for _, h := range s.after {
+		h(ctx)
+	}
+	return true
+}
@@ -0,0 +1,89 @@
+package telestage
+
+import (
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSkip(t *testing.T) {
+	var handled []string
+	ignoreStickers := func(next EventFn) EventFn {
+		return func(ctx Context) {
+			if ctx.Message().Sticker != nil {
+				Skip(ctx)
+				return
+			}
+			next(ctx)
+		}
+	}
+
+	s := NewScene()
+	s.OnMessage(func(Context) { handled = append(handled, "message") }, ignoreStickers)
+	s.OnSticker(func(Context) { handled = append(handled, "sticker") })
+	s.After(func(ctx Context) { handled = append(handled, "after "+RouteName(ctx)) })
+
+	var infos []UpdateInfo
+	stage := NewStage(func(Context) string { return "main" })
+	stage.Add("main", s)
+	stage.Observe(func(_ Context, info UpdateInfo) { infos = append(infos, info) })
+
+	require.NoError(t, stage.Run(&tgbotapi.BotAPI{}, userMessage(1, 1, "hi")))
+	sticker := userMessage(1, 2, "")
+	sticker.Message.Sticker = &tgbotapi.Sticker{FileID: "s"}
+	require.NoError(t, stage.Run(&tgbotapi.BotAPI{}, sticker))
+
+	assert.Equal(t, []string{"message", "after message", "sticker", "after sticker"}, handled)
+	require.Len(t, infos, 2)
+	assert.Equal(t, "sticker", infos[1].Route)
+}
+
+func TestSkip_Unhandled(t *testing.T) {
+	s := NewScene()
+	s.OnMessage(func(Context) { t.Fatal("must be skipped") }, func(EventFn) EventFn {
+		return Skip
+	})
+
+	var info UpdateInfo
+	stage := NewStage(func(Context) string { return "main" })
+	stage.Add("main", s)
+	stage.Observe(func(_ Context, i UpdateInfo) { info = i })
+
+	require.NoError(t, stage.Run(&tgbotapi.BotAPI{}, userMessage(1, 1, "hi")))
+	assert.False(t, info.Handled())
+	assert.Empty(t, info.Route)
+}
+
+func TestAbort(t *testing.T) {
+	var handled []string
+	privateOnly := func(next EventFn) EventFn {
+		return func(ctx Context) {
+			if !ctx.Chat().IsPrivate() {
+				Abort(ctx)
+				return
+			}
+			next(ctx)
+		}
+	}
+
+	s := NewScene()
+	s.OnMessage(func(Context) { handled = append(handled, "private") }, privateOnly)
+	s.OnMessage(func(Context) { handled = append(handled, "fallback") })
+	s.After(func(Context) { handled = append(handled, "after") })
+
+	var info UpdateInfo
+	stage := NewStage(func(Context) string { return "main" })
+	stage.Add("main", s)
+	stage.Observe(func(_ Context, i UpdateInfo) { info = i })
+
+	require.NoError(t, stage.Run(&tgbotapi.BotAPI{}, *groupMessage(-1, 1, "hi").upd))
+	assert.Empty(t, handled, "no other route and no after hooks")
+	assert.True(t, info.Aborted)
+	assert.Equal(t, "message", info.Route)
+
+	require.NoError(t, stage.Run(&tgbotapi.BotAPI{}, userMessage(1, 1, "hi")))
+	assert.Equal(t, []string{"private", "after"}, handled)
+	assert.False(t, info.Aborted)
+}
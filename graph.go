@@ -0,0 +1,140 @@
+package telestage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Scenes returns the states of the scenes added to the stage, sorted.
+func (s *Stage) Scenes() []string {
+	states := make([]string, 0, len(s.scenes))
+	for state := range s.scenes {
+		states = append(states, state)
+	}
+	sort.Strings(states)
+	return states
+}
+
+// Scene returns the scene with the state.
+func (s *Stage) Scene(state string) (*Scene, bool) {
+	scene, ok := s.scenes[state]
+	return scene, ok
+}
+
+// graphEdge is a route moving users from a scene to another one
+type graphEdge struct {
+	from, to, route string
+}
+
+// graph returns the states of the scenes and of the missing targets, and
+// the edges declared with Route.To and Scene.AllowTransitions
+func (s *Stage) graph() (nodes []string, missing map[string]bool, edges []graphEdge) {
+	nodes = s.Scenes()
+	missing = map[string]bool{}
+	for _, state := range nodes {
+		scene := s.scenes[state]
+		routed := map[string]bool{}
+		for _, r := range scene.Routes() {
+			for _, to := range r.targets {
+				routed[to] = true
+				edges = append(edges, graphEdge{from: state, to: to, route: r.name})
+			}
+		}
+		for _, to := range scene.AllowedTransitions() {
+			if !routed[to] {
+				edges = append(edges, graphEdge{from: state, to: to})
+			}
+			if _, ok := s.scenes[to]; !ok {
+				missing[to] = true
+			}
+		}
+	}
+
+	extra := make([]string, 0, len(missing))
+	for state := range missing {
+		extra = append(extra, state)
+	}
+	sort.Strings(extra)
+	return append(nodes, extra...), missing, edges
+}
+
+func stateLabel(state string) string {
+	if state == "" {
+		return `""`
+	}
+	return state
+}
+
+// sceneLines returns the label of the scene: the state and the names of its routes
+func (s *Stage) sceneLines(state string) []string {
+	lines := []string{stateLabel(state)}
+	if scene, ok := s.scenes[state]; ok {
+		for _, r := range scene.Routes() {
+			lines = append(lines, r.name)
+		}
+	}
+	return lines
+}
+
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// DOT renders the scenes with their routes and their transitions as a Graphviz graph. Targets without a scene are dashed.
+func (s *Stage) DOT() string {
+	nodes, missing, edges := s.graph()
+	ids := map[string]string{}
+
+	var b strings.Builder
+	b.WriteString("digraph stage {\n\tnode [shape=box];\n")
+	for i, state := range nodes {
+		ids[state] = fmt.Sprintf("s%d", i)
+		lines := s.sceneLines(state)
+		for j := range lines {
+			lines[j] = dotEscaper.Replace(lines[j])
+		}
+		style := ""
+		if missing[state] {
+			style = ", style=dashed"
+		}
+		fmt.Fprintf(&b, "\t%s [label=\"%s\\l\"%s];\n", ids[state], strings.Join(lines, `\l`), style)
+	}
+	for _, e := range edges {
+		if e.route == "" {
+			fmt.Fprintf(&b, "\t%s -> %s;\n", ids[e.from], ids[e.to])
+			continue
+		}
+		fmt.Fprintf(&b, "\t%s -> %s [label=\"%s\"];\n", ids[e.from], ids[e.to], dotEscaper.Replace(e.route))
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+var mermaidEscaper = strings.NewReplacer(`"`, "#quot;", "<", "#lt;", ">", "#gt;", "|", "#124;", "\n", " ")
+
+// Mermaid renders the scenes with their routes and their transitions as a Mermaid flowchart. Targets without a scene are dashed.
+func (s *Stage) Mermaid() string {
+	nodes, missing, edges := s.graph()
+	ids := map[string]string{}
+
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+	for i, state := range nodes {
+		ids[state] = fmt.Sprintf("s%d", i)
+		lines := s.sceneLines(state)
+		for j := range lines {
+			lines[j] = mermaidEscaper.Replace(lines[j])
+		}
+		fmt.Fprintf(&b, "    %s[\"%s\"]\n", ids[state], strings.Join(lines, "<br/>"))
+		if missing[state] {
+			fmt.Fprintf(&b, "    style %s stroke-dasharray: 5 5\n", ids[state])
+		}
+	}
+	for _, e := range edges {
+		if e.route == "" {
+			fmt.Fprintf(&b, "    %s --> %s\n", ids[e.from], ids[e.to])
+			continue
+		}
+		fmt.Fprintf(&b, "    %s -->|\"%s\"| %s\n", ids[e.from], mermaidEscaper.Replace(e.route), ids[e.to])
+	}
+	return b.String()
+}
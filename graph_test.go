@@ -0,0 +1,91 @@
+package telestage
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func graphStage() *Stage {
+	main := NewScene()
+	main.Use(noopMiddleware)
+	main.OnStart(func(Context) {})
+	main.OnCommand("settings", func(Context) {}).To("settings")
+	main.OnCallback(NewCallbackRoute("item:{id}"), func(Context) {}).To("item", "cart")
+
+	settings := NewScene()
+	settings.OnText(`Say "hi"`, func(Context) {}).To("main")
+	settings.OnMessage(func(Context) {})
+
+	stage := NewStage(func(Context) string { return "main" })
+	stage.Add("main", main)
+	stage.Add("settings", settings)
+	return stage
+}
+
+func TestRoute_Metadata(t *testing.T) {
+	stage := graphStage()
+	assert.Equal(t, []string{"main", "settings"}, stage.Scenes())
+
+	main, ok := stage.Scene("main")
+	require.True(t, ok)
+	routes := main.Routes()
+	require.Len(t, routes, 3)
+
+	assert.Equal(t, RouteCommand, routes[0].Kind())
+	assert.Equal(t, "start", routes[0].Pattern())
+	assert.Equal(t, "command:start", routes[0].Name())
+	assert.Equal(t, []string{"telestage.noopMiddleware"}, routes[0].Middleware())
+	assert.Equal(t, "graph_test.go", filepath.Base(strings.Split(routes[0].Source(), ":")[0]))
+
+	assert.Equal(t, RouteCallback, routes[2].Kind())
+	assert.Equal(t, "item:{id}", routes[2].Pattern())
+	assert.Equal(t, []string{"item", "cart"}, routes[2].Targets())
+
+	_, ok = stage.Scene("missing")
+	assert.False(t, ok)
+}
+
+func TestStage_DOT(t *testing.T) {
+	assert.Equal(t, `digraph stage {
+	node [shape=box];
+	s0 [label="main\lcommand:start\lcommand:settings\lcallback:item:{id}\l"];
+	s1 [label="settings\ltext:Say \"hi\"\lmessage\l"];
+	s2 [label="cart\l", style=dashed];
+	s3 [label="item\l", style=dashed];
+	s0 -> s1 [label="command:settings"];
+	s0 -> s3 [label="callback:item:{id}"];
+	s0 -> s2 [label="callback:item:{id}"];
+	s1 -> s0 [label="text:Say \"hi\""];
+}
+`, graphStage().DOT())
+}
+
+func TestStage_Mermaid(t *testing.T) {
+	assert.Equal(t, `flowchart LR
+    s0["main<br/>command:start<br/>command:settings<br/>callback:item:{id}"]
+    s1["settings<br/>text:Say #quot;hi#quot;<br/>message"]
+    s2["cart"]
+    style s2 stroke-dasharray: 5 5
+    s3["item"]
+    style s3 stroke-dasharray: 5 5
+    s0 -->|"command:settings"| s1
+    s0 -->|"callback:item:{id}"| s3
+    s0 -->|"callback:item:{id}"| s2
+    s1 -->|"text:Say #quot;hi#quot;"| s0
+`, graphStage().Mermaid())
+}
+
+func TestStage_GraphTransitions(t *testing.T) {
+	stage := NewStage(func(Context) string { return "main" })
+	main := NewScene()
+	main.AllowTransitions("settings")
+	stage.Add("main", main)
+	stage.Add("settings", NewScene())
+
+	assert.Contains(t, stage.DOT(), "\ts0 -> s1;\n")
+	assert.Contains(t, stage.Mermaid(), "    s0 --> s1\n")
+}
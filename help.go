@@ -0,0 +1,125 @@
+package telestage
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Help replies with the described commands of the scene handling the
+// update, with their usage, and with the details of a single command for
+// "/help <command>":
+//
+//	help := telestage.NewHelp(stg)
+//	help.Access = ac
+//	scene.OnCommand("help", help.Handler()).Describe("Show commands").Usage("[command]")
+type Help struct {
+	// Access, if set, hides the commands the sender lacks the roles for, see Route.Roles.
+	Access *AccessControl
+	// Header is the first line of the list of commands.
+	Header string
+	// Footer is the last line of the list of commands.
+	Footer string
+	// Unknown is the reply to the help of a command the sender cannot see,
+	// formatted with the command.
+	Unknown string
+
+	stage *Stage
+}
+
+func NewHelp(stage *Stage) *Help {
+	return &Help{
+		Header:  "Commands:",
+		Footer:  "Send /help <command> for details.",
+		Unknown: "Unknown command /%s.",
+		stage:   stage,
+	}
+}
+
+// Handler replies with Text, or with CommandText when the command has an argument.
+func (h *Help) Handler() EventFn {
+	return func(ctx Context) {
+		var cmd string
+		if m := ctx.Message(); m != nil {
+			cmd = strings.TrimPrefix(strings.TrimSpace(m.CommandArguments()), "/")
+		}
+		if cmd != "" {
+			_, _ = ctx.Reply(h.CommandText(ctx, cmd))
+			return
+		}
+		_, _ = ctx.Reply(h.Text(ctx))
+	}
+}
+
+// Commands returns the described commands of the scene handling the update
+// which the sender has the roles for.
+func (h *Help) Commands(ctx Context) []*Route {
+	scene, ok := h.stage.scenes[SceneName(ctx)]
+	if !ok {
+		return nil
+	}
+
+	var routes []*Route
+	listed := map[string]bool{}
+	for _, r := range scene.Routes() {
+		if r.command == "" || len(r.descriptions) == 0 || listed[r.command] || !h.allowed(ctx, r) {
+			continue
+		}
+		listed[r.command] = true
+		routes = append(routes, r)
+	}
+	return routes
+}
+
+func (h *Help) allowed(ctx Context, r *Route) bool {
+	if len(r.roles) == 0 || h.Access == nil {
+		return true
+	}
+	ok, err := h.Access.HasRole(ctx, r.roles...)
+	return err == nil && ok
+}
+
+// Text returns the list of commands with their usage and descriptions.
+func (h *Help) Text(ctx Context) string {
+	lang := helpLanguage(ctx)
+	lines := []string{h.Header}
+	for _, r := range h.Commands(ctx) {
+		lines = append(lines, commandUsage(r)+" — "+r.Description(lang))
+	}
+	if h.Footer != "" {
+		lines = append(lines, "", h.Footer)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// CommandText returns the usage, the description and the details of the command.
+func (h *Help) CommandText(ctx Context, cmd string) string {
+	for _, r := range h.Commands(ctx) {
+		if r.command != cmd {
+			continue
+		}
+		text := commandUsage(r) + "\n" + r.Description(helpLanguage(ctx))
+		if r.details != "" {
+			text += "\n\n" + r.details
+		}
+		return text
+	}
+	return fmt.Sprintf(h.Unknown, cmd)
+}
+
+func commandUsage(r *Route) string {
+	if r.usage == "" {
+		return "/" + r.command
+	}
+	return "/" + r.command + " " + r.usage
+}
+
+// helpLanguage returns the locale resolved by I18n or the language of the Telegram client
+func helpLanguage(ctx Context) string {
+	if l := Locale(ctx); l != "" {
+		return l
+	}
+	if u := ctx.Sender(); u != nil {
+		return u.LanguageCode
+	}
+	return ""
+}
@@ -0,0 +1,66 @@
+package telestage
+
+import (
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHelp(t *testing.T) {
+	srv, bot := newTestBot(t)
+
+	ac := NewAccessControl(StaticRoles(map[int64][]string{1: {"admin"}}))
+	ac.OnDenied = nil
+	stage := NewStage(func(Context) string { return "main" })
+	help := NewHelp(stage)
+	help.Access = ac
+
+	var banned bool
+	s := NewScene()
+	s.Use(ac.RequireRouteRoles())
+	s.OnStart(func(Context) {}).Describe("Start the bot").DescribeIn("uk", "Запустити бота")
+	s.OnCommand("help", help.Handler()).Describe("Show commands").Usage("[command]")
+	s.OnCommand("ban", func(Context) { banned = true }).
+		Describe("Ban a user").
+		Usage("<user> [reason]").
+		Details("The user is banned in all chats of the bot.").
+		Roles("admin")
+	s.OnCommand("debug", func(Context) {})
+	stage.Add("main", s)
+
+	command := func(userID int64, lang, text string) string {
+		upd := userMessage(userID, 1, text)
+		upd.Message.From.LanguageCode = lang
+		upd.Message.Entities = []tgbotapi.MessageEntity{{Type: "bot_command", Length: len(strings.Fields(text)[0])}}
+		require.NoError(t, stage.Run(bot, upd))
+		calls := srv.CallsTo("sendMessage")
+		if len(calls) == 0 {
+			return ""
+		}
+		return calls[len(calls)-1].Params.Get("text")
+	}
+
+	assert.Equal(t, "Commands:\n"+
+		"/start — Start the bot\n"+
+		"/help [command] — Show commands\n"+
+		"/ban <user> [reason] — Ban a user\n"+
+		"\n"+
+		"Send /help <command> for details.", command(1, "en", "/help"))
+	assert.Equal(t, "Commands:\n"+
+		"/start — Запустити бота\n"+
+		"/help [command] — Show commands\n"+
+		"\n"+
+		"Send /help <command> for details.", command(2, "uk", "/help"))
+
+	assert.Equal(t, "/ban <user> [reason]\nBan a user\n\nThe user is banned in all chats of the bot.", command(1, "en", "/help /ban"))
+	assert.Equal(t, "Unknown command /ban.", command(2, "en", "/help ban"))
+	assert.Equal(t, "Unknown command /debug.", command(1, "en", "/help debug"), "undescribed commands are hidden")
+
+	command(2, "en", "/ban")
+	assert.False(t, banned, "route roles are enforced")
+	command(1, "en", "/ban")
+	assert.True(t, banned)
+}
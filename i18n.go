@@ -0,0 +1,387 @@
+package telestage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	i18nKey   = "telestage.i18n"
+	localeKey = "telestage.locale"
+)
+
+// Args are the values of translation placeholders like {name}.
+// The "count" argument selects the plural form.
+type Args map[string]interface{}
+
+// PluralRule returns the plural category of n: "zero", "one", "two", "few", "many" or "other".
+type PluralRule func(n int) string
+
+var pluralCategories = map[string]bool{"zero": true, "one": true, "two": true, "few": true, "many": true, "other": true}
+
+func pluralOneOther(n int) string {
+	if n == 1 {
+		return "one"
+	}
+	return "other"
+}
+
+func pluralEastSlavic(n int) string {
+	switch {
+	case n%10 == 1 && n%100 != 11:
+		return "one"
+	case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+		return "few"
+	default:
+		return "many"
+	}
+}
+
+// pluralRules are the rules of the languages which differ from English
+var pluralRules = map[string]PluralRule{
+	"uk": pluralEastSlavic,
+	"ru": pluralEastSlavic,
+	"be": pluralEastSlavic,
+	"pl": func(n int) string {
+		switch {
+		case n == 1:
+			return "one"
+		case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+			return "few"
+		default:
+			return "many"
+		}
+	},
+	"fr": func(n int) string {
+		if n == 0 || n == 1 {
+			return "one"
+		}
+		return "other"
+	},
+	"ja": func(int) string { return "other" },
+	"ko": func(int) string { return "other" },
+	"zh": func(int) string { return "other" },
+}
+
+// translation holds the forms of a message by plural category, a message without plurals has only "other"
+type translation map[string]string
+
+// I18n translates messages to the locale of the user. Catalogs are JSON or
+// YAML files named by locale, e.g. "en.yaml", with nested keys joined by dots:
+//
+//	greeting: "Hello, {name}!"
+//	apples:
+//	  one: "{count} apple"
+//	  other: "{count} apples"
+type I18n struct {
+	// DefaultLocale is used when the user locale has no catalog or lacks a key.
+	DefaultLocale string
+	// LocaleGetter, if set, returns the locale chosen by the user, e.g. kept in
+	// a session. When it returns "", the language of the Telegram client is used.
+	LocaleGetter func(Context) string
+
+	lock     sync.RWMutex
+	catalogs map[string]map[string]translation
+	rules    map[string]PluralRule
+}
+
+func NewI18n(defaultLocale string) *I18n {
+	return &I18n{
+		DefaultLocale: defaultLocale,
+		catalogs:      map[string]map[string]translation{},
+		rules:         map[string]PluralRule{},
+	}
+}
+
+// SetPluralRule sets the plural rule of the locale, overriding the built-in one.
+func (i *I18n) SetPluralRule(locale string, rule PluralRule) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	i.rules[normalizeLocale(locale)] = rule
+}
+
+// Add adds the messages to the catalog of the locale. Values are strings,
+// maps of plural forms, or maps of nested keys.
+func (i *I18n) Add(locale string, messages map[string]interface{}) error {
+	flat := map[string]translation{}
+	if err := flattenMessages(flat, "", messages); err != nil {
+		return fmt.Errorf("locale %s: %w", locale, err)
+	}
+
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	locale = normalizeLocale(locale)
+	if i.catalogs[locale] == nil {
+		i.catalogs[locale] = map[string]translation{}
+	}
+	for k, t := range flat {
+		i.catalogs[locale][k] = t
+	}
+	return nil
+}
+
+// LoadFile loads the catalog from the JSON or YAML file, the locale is its name without extension.
+func (i *I18n) LoadFile(name string) error {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	return i.load(name, data)
+}
+
+// LoadFS loads all *.json, *.yaml and *.yml catalogs in the directory of fsys, e.g. an embed.FS.
+func (i *I18n) LoadFS(fsys fs.FS, dir string) error {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		switch path.Ext(e.Name()) {
+		case ".json", ".yaml", ".yml":
+		default:
+			continue
+		}
+		data, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return err
+		}
+		if err := i.load(e.Name(), data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadDir loads all catalogs in the directory.
+func (i *I18n) LoadDir(dir string) error {
+	return i.LoadFS(os.DirFS(dir), ".")
+}
+
+func (i *I18n) load(name string, data []byte) error {
+	var messages map[string]interface{}
+	var err error
+	ext := path.Ext(name)
+	if ext == ".json" {
+		err = json.Unmarshal(data, &messages)
+	} else {
+		err = yaml.Unmarshal(data, &messages)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return i.Add(strings.TrimSuffix(path.Base(name), ext), messages)
+}
+
+func flattenMessages(flat map[string]translation, prefix string, messages map[string]interface{}) error {
+	for k, v := range messages {
+		key := prefix + k
+		switch v := v.(type) {
+		case string:
+			flat[key] = translation{"other": v}
+		case map[string]interface{}:
+			if forms, ok := pluralForms(v); ok {
+				flat[key] = forms
+				continue
+			}
+			if err := flattenMessages(flat, key+".", v); err != nil {
+				return err
+			}
+		case nil:
+			return fmt.Errorf("empty message %s", key)
+		default:
+			if reflect.ValueOf(v).Kind() == reflect.Map || reflect.ValueOf(v).Kind() == reflect.Slice {
+				return fmt.Errorf("unsupported message %s of type %T", key, v)
+			}
+			flat[key] = translation{"other": fmt.Sprint(v)}
+		}
+	}
+	return nil
+}
+
+// pluralForms reports whether the map is the plural forms of a message: all keys are categories, "other" included
+func pluralForms(m map[string]interface{}) (translation, bool) {
+	if _, ok := m["other"]; !ok {
+		return nil, false
+	}
+	forms := translation{}
+	for k, v := range m {
+		s, ok := v.(string)
+		if !ok || !pluralCategories[k] {
+			return nil, false
+		}
+		forms[k] = s
+	}
+	return forms, true
+}
+
+// Locales returns the locales with catalogs.
+func (i *I18n) Locales() []string {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+
+	locales := make([]string, 0, len(i.catalogs))
+	for l := range i.catalogs {
+		locales = append(locales, l)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// Translate returns the message with the key in the locale, falling back to
+// the language without region and to the default locale. Missing messages
+// are returned as the key.
+func (i *I18n) Translate(locale, key string, args ...Args) string {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+
+	locale = normalizeLocale(locale)
+	for _, l := range []string{locale, baseLocale(locale), normalizeLocale(i.DefaultLocale)} {
+		if t, ok := i.catalogs[l][key]; ok {
+			return format(t[i.form(l, t, args)], args)
+		}
+	}
+	return key
+}
+
+// form selects the plural form of the translation by the "count" argument
+func (i *I18n) form(locale string, t translation, args []Args) string {
+	if len(t) == 1 {
+		return "other"
+	}
+
+	var n int
+	for _, a := range args {
+		if c, ok := a["count"]; ok {
+			switch v := reflect.ValueOf(c); v.Kind() {
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+				n = int(v.Int())
+			case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+				n = int(v.Uint())
+			}
+		}
+	}
+
+	rule, ok := i.rules[locale]
+	if !ok {
+		if rule, ok = pluralRules[baseLocale(locale)]; !ok {
+			rule = pluralOneOther
+		}
+	}
+	if n == 0 {
+		if _, ok := t["zero"]; ok {
+			return "zero"
+		}
+	}
+	if form := rule(n); t[form] != "" {
+		return form
+	}
+	return "other"
+}
+
+// format replaces the {name} placeholders with the arguments
+func format(s string, args []Args) string {
+	if len(args) == 0 || !strings.Contains(s, "{") {
+		return s
+	}
+
+	var pairs []string
+	for _, a := range args {
+		for k, v := range a {
+			pairs = append(pairs, "{"+k+"}", fmt.Sprint(v))
+		}
+	}
+	return strings.NewReplacer(pairs...).Replace(s)
+}
+
+// Texts returns the translations of the key in all locales, e.g. to match
+// the label of a reply keyboard button in any language.
+func (i *I18n) Texts(key string) []string {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+
+	var texts []string
+	for _, catalog := range i.catalogs {
+		if t, ok := catalog[key]; ok {
+			texts = append(texts, t["other"])
+		}
+	}
+	return texts
+}
+
+// ResolveLocale returns the locale of the user: the one from LocaleGetter,
+// or the language of the Telegram client if it has a catalog, or the default.
+func (i *I18n) ResolveLocale(ctx Context) string {
+	if i.LocaleGetter != nil {
+		if l := i.LocaleGetter(ctx); l != "" {
+			return normalizeLocale(l)
+		}
+	}
+
+	if u := ctx.Sender(); u != nil && u.LanguageCode != "" {
+		l := normalizeLocale(u.LanguageCode)
+		i.lock.RLock()
+		defer i.lock.RUnlock()
+		if _, ok := i.catalogs[l]; ok {
+			return l
+		}
+		if _, ok := i.catalogs[baseLocale(l)]; ok {
+			return baseLocale(l)
+		}
+	}
+	return normalizeLocale(i.DefaultLocale)
+}
+
+// Middleware resolves the locale of the update, so Context.T translates to it.
+func (i *I18n) Middleware() Middleware {
+	return func(next EventFn) EventFn {
+		return func(ctx Context) {
+			ctx.Set(i18nKey, i)
+			ctx.Set(localeKey, i.ResolveLocale(ctx))
+			next(ctx)
+		}
+	}
+}
+
+// OnText handles messages with the text of the key in any locale, like Scene.OnText.
+func (i *I18n) OnText(s *Scene, key string, ef EventFn, mw ...Middleware) *Route {
+	return s.handle(RouteText, key, func(ctx Context) bool {
+		m := ctx.Upd().Message
+		if m == nil {
+			return false
+		}
+		for _, t := range i.Texts(key) {
+			if t == m.Text {
+				return true
+			}
+		}
+		return false
+	}, ef, mw)
+}
+
+// Locale returns the locale resolved by I18n.Middleware.
+func Locale(ctx Context) string {
+	l, _ := ctx.Get(localeKey).(string)
+	return l
+}
+
+func normalizeLocale(l string) string {
+	return strings.ToLower(strings.ReplaceAll(l, "_", "-"))
+}
+
+func baseLocale(l string) string {
+	if i := strings.IndexByte(l, '-'); i > 0 {
+		return l[:i]
+	}
+	return l
+}
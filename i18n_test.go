@@ -0,0 +1,88 @@
+package telestage
+
+import (
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestI18n(t *testing.T) *I18n {
+	i := NewI18n("en")
+	require.NoError(t, i.LoadDir("testdata/i18n"))
+	return i
+}
+
+func TestI18n_Translate(t *testing.T) {
+	i := newTestI18n(t)
+	assert.Equal(t, []string{"en", "uk"}, i.Locales())
+
+	tests := []struct {
+		locale, key string
+		args        Args
+		want        string
+	}{
+		{"en", "greeting", Args{"name": "Ann"}, "Hello, Ann!"},
+		{"uk", "greeting", Args{"name": "Ann"}, "Привіт, Ann!"},
+		{"uk-UA", "menu.settings", nil, "Налаштування"},
+		{"en", "apples", Args{"count": 0}, "No apples"},
+		{"en", "apples", Args{"count": 1}, "1 apple"},
+		{"en", "apples", Args{"count": 5}, "5 apples"},
+		{"uk", "apples", Args{"count": 21}, "21 яблуко"},
+		{"uk", "apples", Args{"count": 3}, "3 яблука"},
+		{"uk", "apples", Args{"count": 11}, "11 яблук"},
+		{"uk", "only_en", nil, "English only"},
+		{"de", "greeting", Args{"name": "Ann"}, "Hello, Ann!"},
+		{"en", "missing", nil, "missing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.locale+" "+tt.key, func(t *testing.T) {
+			assert.Equal(t, tt.want, i.Translate(tt.locale, tt.key, tt.args))
+		})
+	}
+}
+
+func TestI18n_PluralRule(t *testing.T) {
+	i := NewI18n("en")
+	require.NoError(t, i.Add("en", map[string]interface{}{
+		"items": map[string]interface{}{"one": "one item", "two": "two items", "other": "items"},
+	}))
+	i.SetPluralRule("en", func(n int) string {
+		if n == 2 {
+			return "two"
+		}
+		return pluralOneOther(n)
+	})
+	assert.Equal(t, "two items", i.Translate("en", "items", Args{"count": 2}))
+}
+
+func TestI18n_Middleware(t *testing.T) {
+	i := newTestI18n(t)
+	var preferred string
+	i.LocaleGetter = func(Context) string { return preferred }
+
+	var got []string
+	s := NewScene()
+	s.Use(i.Middleware())
+	i.OnText(s, "menu.settings", func(ctx Context) {
+		got = append(got, Locale(ctx)+": "+ctx.T("greeting", Args{"name": ctx.Sender().FirstName}))
+	})
+	stage := NewStage(emptyStateGetter)
+	stage.Add("", s)
+
+	run := func(lang, text string) {
+		stage.Run(&tgbotapi.BotAPI{}, tgbotapi.Update{Message: &tgbotapi.Message{
+			From: &tgbotapi.User{FirstName: "Ann", LanguageCode: lang},
+			Text: text,
+		}})
+	}
+	run("uk", "Налаштування")
+	run("fr", "Settings")
+	preferred = "uk"
+	run("en", "Settings")
+	run("en", "Unknown")
+
+	assert.Equal(t, []string{"uk: Привіт, Ann!", "en: Hello, Ann!", "uk: Привіт, Ann!"}, got)
+	assert.Equal(t, "greeting", (&NativeContext{}).T("greeting"), "key is returned without middleware")
+}
@@ -0,0 +1,266 @@
+package telestage
+
+import (
+	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Keyboard size limits of Telegram clients.
+const (
+	MaxInlineRowButtons = 8
+	MaxInlineButtons    = 100
+	MaxReplyRowButtons  = 12
+	MaxReplyButtons     = 300
+)
+
+var (
+	ErrInvalidKeyboard = errors.New("invalid keyboard")
+)
+
+// keyboardLayout decides where the rows of a keyboard break.
+type keyboardLayout struct {
+	// columns is the maximum number of buttons in a row
+	columns int
+	// maxWidth is the maximum total length of the labels in a row
+	maxWidth int
+
+	count, width int
+}
+
+// add places a button with the label and reports whether it starts a new row.
+func (l *keyboardLayout) add(label string) bool {
+	w := utf8.RuneCountInString(label)
+	wrap := l.count == 0 ||
+		l.columns > 0 && l.count >= l.columns ||
+		l.maxWidth > 0 && l.width+w > l.maxWidth
+	if wrap {
+		l.count, l.width = 0, 0
+	}
+	l.count++
+	l.width += w
+	return wrap
+}
+
+// breakRow makes the next button start a new row.
+func (l *keyboardLayout) breakRow() {
+	l.count, l.width = 0, 0
+}
+
+func checkKeyboardSize(rowLens []int, maxRow, maxTotal int) error {
+	total := 0
+	for i, n := range rowLens {
+		if n > maxRow {
+			return fmt.Errorf("%w: row %d has %d buttons, the limit is %d", ErrInvalidKeyboard, i+1, n, maxRow)
+		}
+		total += n
+	}
+	if total > maxTotal {
+		return fmt.Errorf("%w: %d buttons, the limit is %d", ErrInvalidKeyboard, total, maxTotal)
+	}
+	return nil
+}
+
+// InlineKeyboard builds tgbotapi.InlineKeyboardMarkup. Buttons are added to
+// the current row, which is broken with Row or automatically by Columns and
+// MaxWidth. Errors are reported by Build.
+type InlineKeyboard struct {
+	layout keyboardLayout
+	rows   [][]tgbotapi.InlineKeyboardButton
+	err    error
+}
+
+func NewInlineKeyboard() *InlineKeyboard {
+	return &InlineKeyboard{}
+}
+
+// Columns wraps rows after n buttons.
+func (k *InlineKeyboard) Columns(n int) *InlineKeyboard {
+	k.layout.columns = n
+	return k
+}
+
+// MaxWidth wraps rows when the total length of the labels exceeds n characters.
+func (k *InlineKeyboard) MaxWidth(n int) *InlineKeyboard {
+	k.layout.maxWidth = n
+	return k
+}
+
+// Row starts a new row.
+func (k *InlineKeyboard) Row() *InlineKeyboard {
+	k.layout.breakRow()
+	return k
+}
+
+// Button adds a button as is.
+func (k *InlineKeyboard) Button(b tgbotapi.InlineKeyboardButton) *InlineKeyboard {
+	if b.Text == "" && k.err == nil {
+		k.err = fmt.Errorf("%w: button without text", ErrInvalidKeyboard)
+	}
+	if b.CallbackData != nil && (*b.CallbackData == "" || len(*b.CallbackData) > MaxCallbackData) && k.err == nil {
+		k.err = fmt.Errorf("%w: callback data of %q must be 1-%d bytes", ErrInvalidKeyboard, b.Text, MaxCallbackData)
+	}
+
+	if k.layout.add(b.Text) {
+		k.rows = append(k.rows, nil)
+	}
+	k.rows[len(k.rows)-1] = append(k.rows[len(k.rows)-1], b)
+	return k
+}
+
+// Data adds a callback button.
+func (k *InlineKeyboard) Data(text, data string) *InlineKeyboard {
+	return k.Button(tgbotapi.NewInlineKeyboardButtonData(text, data))
+}
+
+// Callback adds a callback button with the data of the route filled with values.
+func (k *InlineKeyboard) Callback(text string, route *CallbackRoute, values ...interface{}) *InlineKeyboard {
+	data, err := route.Data(values...)
+	if err != nil && k.err == nil {
+		k.err = err
+	}
+	return k.Data(text, data)
+}
+
+func (k *InlineKeyboard) URL(text, url string) *InlineKeyboard {
+	return k.Button(tgbotapi.NewInlineKeyboardButtonURL(text, url))
+}
+
+// WebApp adds a button opening the Web App at the url.
+func (k *InlineKeyboard) WebApp(text, url string) *InlineKeyboard {
+	return k.Button(tgbotapi.NewInlineKeyboardButtonWebApp(text, tgbotapi.WebAppInfo{URL: url}))
+}
+
+// Login adds a button authorizing the user on the website of the login URL.
+func (k *InlineKeyboard) Login(text string, login tgbotapi.LoginURL) *InlineKeyboard {
+	return k.Button(tgbotapi.NewInlineKeyboardButtonLoginURL(text, login))
+}
+
+// SwitchInline adds a button inserting the inline query into a chat the user selects.
+func (k *InlineKeyboard) SwitchInline(text, query string) *InlineKeyboard {
+	return k.Button(tgbotapi.NewInlineKeyboardButtonSwitch(text, query))
+}
+
+// SwitchInlineCurrentChat adds a button inserting the inline query into the current chat.
+func (k *InlineKeyboard) SwitchInlineCurrentChat(text, query string) *InlineKeyboard {
+	return k.Button(tgbotapi.InlineKeyboardButton{Text: text, SwitchInlineQueryCurrentChat: &query})
+}
+
+// Build returns the markup, or the first error of the added buttons.
+func (k *InlineKeyboard) Build() (tgbotapi.InlineKeyboardMarkup, error) {
+	markup := tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}}
+	if k.err != nil {
+		return markup, k.err
+	}
+
+	rowLens := make([]int, len(k.rows))
+	for i, row := range k.rows {
+		rowLens[i] = len(row)
+	}
+	if err := checkKeyboardSize(rowLens, MaxInlineRowButtons, MaxInlineButtons); err != nil {
+		return markup, err
+	}
+
+	markup.InlineKeyboard = append(markup.InlineKeyboard, k.rows...)
+	return markup, nil
+}
+
+// ReplyKeyboard builds tgbotapi.ReplyKeyboardMarkup, laid out as InlineKeyboard.
+type ReplyKeyboard struct {
+	layout keyboardLayout
+	markup tgbotapi.ReplyKeyboardMarkup
+	err    error
+}
+
+func NewReplyKeyboard() *ReplyKeyboard {
+	return &ReplyKeyboard{}
+}
+
+// Columns wraps rows after n buttons.
+func (k *ReplyKeyboard) Columns(n int) *ReplyKeyboard {
+	k.layout.columns = n
+	return k
+}
+
+// MaxWidth wraps rows when the total length of the labels exceeds n characters.
+func (k *ReplyKeyboard) MaxWidth(n int) *ReplyKeyboard {
+	k.layout.maxWidth = n
+	return k
+}
+
+// Row starts a new row.
+func (k *ReplyKeyboard) Row() *ReplyKeyboard {
+	k.layout.breakRow()
+	return k
+}
+
+// Resize asks clients to fit the keyboard to its buttons.
+func (k *ReplyKeyboard) Resize() *ReplyKeyboard {
+	k.markup.ResizeKeyboard = true
+	return k
+}
+
+// OneTime hides the keyboard after a button is pressed.
+func (k *ReplyKeyboard) OneTime() *ReplyKeyboard {
+	k.markup.OneTimeKeyboard = true
+	return k
+}
+
+// Placeholder is shown in the input field while the keyboard is active.
+func (k *ReplyKeyboard) Placeholder(text string) *ReplyKeyboard {
+	k.markup.InputFieldPlaceholder = text
+	return k
+}
+
+// Button adds a button as is.
+func (k *ReplyKeyboard) Button(b tgbotapi.KeyboardButton) *ReplyKeyboard {
+	if b.Text == "" && k.err == nil {
+		k.err = fmt.Errorf("%w: button without text", ErrInvalidKeyboard)
+	}
+
+	if k.layout.add(b.Text) {
+		k.markup.Keyboard = append(k.markup.Keyboard, nil)
+	}
+	rows := k.markup.Keyboard
+	rows[len(rows)-1] = append(rows[len(rows)-1], b)
+	return k
+}
+
+// Text adds a button sending its text.
+func (k *ReplyKeyboard) Text(text string) *ReplyKeyboard {
+	return k.Button(tgbotapi.NewKeyboardButton(text))
+}
+
+// Contact adds a button sending the phone number of the user.
+func (k *ReplyKeyboard) Contact(text string) *ReplyKeyboard {
+	return k.Button(tgbotapi.NewKeyboardButtonContact(text))
+}
+
+// Location adds a button sending the location of the user.
+func (k *ReplyKeyboard) Location(text string) *ReplyKeyboard {
+	return k.Button(tgbotapi.NewKeyboardButtonLocation(text))
+}
+
+// WebApp adds a button opening the Web App at the url.
+func (k *ReplyKeyboard) WebApp(text, url string) *ReplyKeyboard {
+	return k.Button(tgbotapi.NewKeyboardButtonWebApp(text, tgbotapi.WebAppInfo{URL: url}))
+}
+
+// Build returns the markup, or the first error of the added buttons.
+func (k *ReplyKeyboard) Build() (tgbotapi.ReplyKeyboardMarkup, error) {
+	markup := k.markup
+	if markup.Keyboard == nil {
+		markup.Keyboard = [][]tgbotapi.KeyboardButton{}
+	}
+	if k.err != nil {
+		return markup, k.err
+	}
+
+	rowLens := make([]int, len(markup.Keyboard))
+	for i, row := range markup.Keyboard {
+		rowLens[i] = len(row)
+	}
+	return markup, checkKeyboardSize(rowLens, MaxReplyRowButtons, MaxReplyButtons)
+}
@@ -0,0 +1,105 @@
+package telestage
+
+import (
+	"errors"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func rowLabels(rows [][]tgbotapi.InlineKeyboardButton) [][]string {
+	var labels [][]string
+	for _, row := range rows {
+		var l []string
+		for _, b := range row {
+			l = append(l, b.Text)
+		}
+		labels = append(labels, l)
+	}
+	return labels
+}
+
+func TestInlineKeyboard_Layout(t *testing.T) {
+	markup, err := NewInlineKeyboard().Columns(2).
+		Data("1", "1").Data("2", "2").Data("3", "3").
+		Row().
+		URL("site", "https://example.com").
+		Build()
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"1", "2"}, {"3"}, {"site"}}, rowLabels(markup.InlineKeyboard))
+
+	markup, err = NewInlineKeyboard().MaxWidth(10).
+		Data("short", "a").Data("long", "b").Data("longer", "c").
+		Build()
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"short", "long"}, {"longer"}}, rowLabels(markup.InlineKeyboard))
+}
+
+func TestInlineKeyboard_Buttons(t *testing.T) {
+	route := NewCallbackRoute("item:{id}")
+	markup, err := NewInlineKeyboard().
+		Callback("open", route, 5).
+		WebApp("app", "https://example.com/app").
+		Login("login", tgbotapi.LoginURL{URL: "https://example.com/login"}).
+		SwitchInline("share", "q").
+		SwitchInlineCurrentChat("search", "").
+		Build()
+	require.NoError(t, err)
+
+	row := markup.InlineKeyboard[0]
+	require.Len(t, row, 5)
+	assert.Equal(t, "item:5", *row[0].CallbackData)
+	assert.Equal(t, "https://example.com/app", row[1].WebApp.URL)
+	assert.Equal(t, "https://example.com/login", row[2].LoginURL.URL)
+	assert.Equal(t, "q", *row[3].SwitchInlineQuery)
+	assert.Equal(t, "", *row[4].SwitchInlineQueryCurrentChat)
+}
+
+func TestInlineKeyboard_Limits(t *testing.T) {
+	tests := []struct {
+		name string
+		kb   *InlineKeyboard
+	}{
+		{"empty text", NewInlineKeyboard().Data("", "a")},
+		{"long data", NewInlineKeyboard().Data("a", string(make([]byte, MaxCallbackData+1)))},
+		{"route error", NewInlineKeyboard().Callback("a", NewCallbackRoute("{id}"))},
+		{"wide row", NewInlineKeyboard().Data("1", "1").Data("2", "2").Data("3", "3").Data("4", "4").
+			Data("5", "5").Data("6", "6").Data("7", "7").Data("8", "8").Data("9", "9")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.kb.Build()
+			assert.Error(t, err)
+		})
+	}
+
+	kb := NewInlineKeyboard().Columns(1)
+	for i := 0; i <= MaxInlineButtons; i++ {
+		kb.Data("b", "b")
+	}
+	_, err := kb.Build()
+	assert.True(t, errors.Is(err, ErrInvalidKeyboard))
+}
+
+func TestReplyKeyboard(t *testing.T) {
+	markup, err := NewReplyKeyboard().Columns(2).Resize().OneTime().Placeholder("choose").
+		Text("yes").Text("no").
+		Contact("phone").Location("where").
+		Row().
+		WebApp("app", "https://example.com/app").
+		Build()
+	require.NoError(t, err)
+
+	assert.True(t, markup.ResizeKeyboard)
+	assert.True(t, markup.OneTimeKeyboard)
+	assert.Equal(t, "choose", markup.InputFieldPlaceholder)
+	require.Len(t, markup.Keyboard, 3)
+	assert.True(t, markup.Keyboard[1][0].RequestContact)
+	assert.True(t, markup.Keyboard[1][1].RequestLocation)
+	assert.Equal(t, "https://example.com/app", markup.Keyboard[2][0].WebApp.URL)
+
+	_, err = NewReplyKeyboard().Text("").Build()
+	assert.True(t, errors.Is(err, ErrInvalidKeyboard))
+}
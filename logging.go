@@ -0,0 +1,233 @@
+package telestage
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	LogKindUpdate = "update"
+	LogKindAPI    = "api"
+)
+
+const redacted = "[redacted]"
+
+const loggedKey = "telestage.logged"
+
+// LogRecord describes a handled update or an outgoing Bot API call.
+type LogRecord struct {
+	Time time.Time
+	// Kind is LogKindUpdate or LogKindAPI.
+	Kind string
+
+	UpdateID   int
+	UpdateType string
+	ChatID     int64
+	UserID     int64
+	Scene      string
+	Route      string
+
+	// Method and Status are set for API calls.
+	Method string
+	Status int
+
+	// Text is the message text, callback data or the text of an outgoing
+	// message, "[redacted]" unless Logging.LogText is set.
+	Text     string
+	Duration time.Duration
+	Err      error
+}
+
+// String formats the record as key=value pairs, omitting empty fields.
+func (r LogRecord) String() string {
+	var b strings.Builder
+	b.WriteString(r.Kind)
+	add := func(k, v string) {
+		if v != "" && v != "0" {
+			b.WriteString(" " + k + "=" + v)
+		}
+	}
+	add("id", strconv.Itoa(r.UpdateID))
+	add("type", r.UpdateType)
+	add("chat", strconv.FormatInt(r.ChatID, 10))
+	add("user", strconv.FormatInt(r.UserID, 10))
+	add("scene", r.Scene)
+	add("route", r.Route)
+	add("method", r.Method)
+	add("status", strconv.Itoa(r.Status))
+	if r.Text != "" {
+		add("text", strconv.Quote(r.Text))
+	}
+	add("duration", r.Duration.String())
+	if r.Err != nil {
+		add("error", strconv.Quote(r.Err.Error()))
+	}
+	return b.String()
+}
+
+// Logger receives log records.
+type Logger interface {
+	Log(LogRecord)
+}
+
+// LoggerFunc is an adapter to allow the use of ordinary functions as Logger,
+// e.g. to pass records to a structured logging library.
+type LoggerFunc func(LogRecord)
+
+func (f LoggerFunc) Log(r LogRecord) {
+	f(r)
+}
+
+// StdLogger writes records to the standard logger, log.Default() if l is nil.
+func StdLogger(l *log.Logger) Logger {
+	if l == nil {
+		l = log.Default()
+	}
+	return LoggerFunc(func(r LogRecord) {
+		l.Println(r.String())
+	})
+}
+
+// Logging logs updates with Observer and outgoing Bot API calls with Client.
+type Logging struct {
+	Logger Logger
+	// LogText includes texts of messages into records, they are redacted by default.
+	LogText bool
+}
+
+func NewLogging(logger Logger) *Logging {
+	return &Logging{Logger: logger}
+}
+
+// Observer returns the UpdateObserver to add with Stage.Observe. It logs
+// every update run by the stage, including unhandled ones and those failed
+// with an error or a panic, with the duration of the whole run.
+func (l *Logging) Observer() UpdateObserver {
+	return func(ctx Context, info UpdateInfo) {
+		r := l.updateRecord(ctx)
+		r.Scene = info.Scene
+		r.Route = info.Route
+		r.Err = info.Err
+		if info.Panic != nil {
+			r.Err = fmt.Errorf("panic: %v", info.Panic)
+		}
+		l.log(r, time.Now().Add(-info.Duration))
+	}
+}
+
+// Middleware logs the updates handled by the scene routes with the handler duration.
+// A panic of the handler is logged as the error and propagated. Use Observer
+// to log the updates no route matched and the errors of Stage.Run as well.
+// An update is logged once, by the route which did not Skip it.
+func (l *Logging) Middleware() Middleware {
+	key := fmt.Sprintf("%s.%p", loggedKey, l)
+	return func(next EventFn) EventFn {
+		return func(ctx Context) {
+			r := l.updateRecord(ctx)
+
+			start := time.Now()
+			defer func() {
+				p := recover()
+				if p != nil || !skipped(ctx) {
+					l.logRoute(ctx, key, r, start, p)
+				}
+				if p != nil {
+					panic(p)
+				}
+			}()
+			next(ctx)
+		}
+	}
+}
+
+// logRoute logs the update handled by the route unless it was logged already
+func (l *Logging) logRoute(ctx Context, key string, r LogRecord, start time.Time, panicked interface{}) {
+	if ctx.Get(key) != nil {
+		return
+	}
+	ctx.Set(key, true)
+
+	// the scene and the route are known once the update is dispatched
+	r.Scene = SceneName(ctx)
+	r.Route = RouteName(ctx)
+	if panicked != nil {
+		r.Err = fmt.Errorf("panic: %v", panicked)
+	}
+	l.log(r, start)
+}
+
+func (l *Logging) updateRecord(ctx Context) LogRecord {
+	r := LogRecord{
+		Kind:       LogKindUpdate,
+		UpdateID:   ctx.Upd().UpdateID,
+		UpdateType: UpdateType(ctx.Upd()),
+		Text:       l.text(updateText(ctx)),
+	}
+	if c := ctx.Chat(); c != nil {
+		r.ChatID = c.ID
+	}
+	if u := ctx.Sender(); u != nil {
+		r.UserID = u.ID
+	}
+	return r
+}
+
+// Client logs outgoing Bot API calls with their status and duration.
+func (l *Logging) Client() ClientMiddleware {
+	return func(next tgbotapi.HTTPClient) tgbotapi.HTTPClient {
+		return ClientFunc(func(req *http.Request) (*http.Response, error) {
+			r := LogRecord{
+				Kind:   LogKindAPI,
+				Method: apiMethod(req),
+			}
+			if params, err := apiParams(req); err == nil {
+				r.ChatID, _ = strconv.ParseInt(params.Get("chat_id"), 10, 64)
+				text := params.Get("text")
+				if text == "" {
+					text = params.Get("caption")
+				}
+				r.Text = l.text(text)
+			}
+
+			start := time.Now()
+			resp, err := next.Do(req)
+			r.Err = err
+			if resp != nil {
+				r.Status = resp.StatusCode
+				if apiResp, perr := peekResponse(resp); perr == nil && !apiResp.Ok {
+					r.Err = &tgbotapi.Error{Code: apiResp.ErrorCode, Message: apiResp.Description}
+				}
+			}
+			l.log(r, start)
+
+			return resp, err
+		})
+	}
+}
+
+func (l *Logging) log(r LogRecord, start time.Time) {
+	r.Time = time.Now()
+	r.Duration = r.Time.Sub(start)
+	l.Logger.Log(r)
+}
+
+func (l *Logging) text(s string) string {
+	if s == "" || l.LogText {
+		return s
+	}
+	return redacted
+}
+
+// updateText returns the text of the message or the data of the callback query
+func updateText(ctx Context) string {
+	if q := ctx.Upd().CallbackQuery; q != nil {
+		return q.Data
+	}
+	return ctx.Text()
+}
@@ -0,0 +1,140 @@
+package telestage
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogging(t *testing.T) {
+	srv, bot := newTestBot(t)
+	srv.FailNext("sendMessage", 403, "Forbidden: bot was blocked by the user", 0)
+
+	var records []LogRecord
+	logging := NewLogging(LoggerFunc(func(r LogRecord) {
+		records = append(records, r)
+	}))
+
+	s := NewScene()
+	s.Use(logging.Middleware())
+	s.OnCommand("start", func(ctx Context) {
+		ctx.Reply("secret reply")
+	})
+	stage := NewStage(func(Context) string { return "main" })
+	stage.Add("main", s)
+	stage.UseClient(logging.Client())
+
+	upd := userMessage(1, 10, "/start")
+	upd.UpdateID = 5
+	upd.Message.Entities = []tgbotapi.MessageEntity{{Type: "bot_command", Length: 6}}
+	require.NoError(t, stage.Run(bot, upd))
+
+	require.Len(t, records, 2)
+	api, update := records[0], records[1]
+
+	assert.Equal(t, LogKindAPI, api.Kind)
+	assert.Equal(t, "sendMessage", api.Method)
+	assert.Equal(t, int64(1), api.ChatID)
+	assert.Equal(t, 403, api.Status)
+	assert.Equal(t, redacted, api.Text)
+	var apiErr *tgbotapi.Error
+	require.True(t, errors.As(api.Err, &apiErr))
+	assert.Equal(t, 403, apiErr.Code)
+
+	assert.Equal(t, LogKindUpdate, update.Kind)
+	assert.Equal(t, 5, update.UpdateID)
+	assert.Equal(t, "message", update.UpdateType)
+	assert.Equal(t, "main", update.Scene)
+	assert.Equal(t, "command:start", update.Route)
+	assert.Equal(t, int64(1), update.UserID)
+	assert.Equal(t, redacted, update.Text)
+	assert.NoError(t, update.Err)
+}
+
+func TestLogging_Observer(t *testing.T) {
+	var records []LogRecord
+	logging := NewLogging(LoggerFunc(func(r LogRecord) {
+		records = append(records, r)
+	}))
+	logging.LogText = true
+
+	s := NewScene()
+	s.OnText("hi", func(Context) {})
+	stage := NewStage(func(ctx Context) string { return ctx.Text() })
+	stage.Add("hi", s)
+	stage.Add("other", NewScene())
+	stage.Observe(logging.Observer())
+	stage.Use(logging.Middleware())
+
+	require.NoError(t, stage.Run(&tgbotapi.BotAPI{}, userMessage(1, 1, "hi")))
+	require.NoError(t, stage.Run(&tgbotapi.BotAPI{}, userMessage(1, 2, "other")))
+	assert.ErrorIs(t, stage.Run(&tgbotapi.BotAPI{}, userMessage(1, 3, "missing")), ErrSceneNotFound)
+
+	require.Len(t, records, 6, "middleware and observer records")
+	for i := 0; i < len(records); i += 2 {
+		assert.Equal(t, records[i].Scene, records[i+1].Scene, "stage middleware must log the resolved scene")
+		assert.Equal(t, records[i].Route, records[i+1].Route)
+	}
+	observed := []LogRecord{records[1], records[3], records[5]}
+	assert.Equal(t, "hi", observed[0].Scene)
+	assert.Equal(t, "text:hi", observed[0].Route)
+	assert.Equal(t, "other", observed[1].Scene, "unhandled update must be logged")
+	assert.Empty(t, observed[1].Route)
+	assert.Equal(t, "missing", observed[2].Text)
+	assert.ErrorIs(t, observed[2].Err, ErrSceneNotFound)
+}
+
+func TestLogging_Skip(t *testing.T) {
+	var records []LogRecord
+	logging := NewLogging(LoggerFunc(func(r LogRecord) {
+		records = append(records, r)
+	}))
+
+	s := NewScene()
+	s.Use(logging.Middleware())
+	s.OnMessage(func(ctx Context) { Skip(ctx) })
+	s.OnText("hi", func(Context) {})
+	stage := NewStage(func(Context) string { return "main" })
+	stage.Add("main", s)
+
+	require.NoError(t, stage.Run(&tgbotapi.BotAPI{}, userMessage(1, 1, "hi")))
+	require.Len(t, records, 1, "logged once per update")
+	assert.Equal(t, "text:hi", records[0].Route)
+}
+
+func TestLogging_Panic(t *testing.T) {
+	var records []LogRecord
+	logging := NewLogging(LoggerFunc(func(r LogRecord) {
+		records = append(records, r)
+	}))
+	logging.LogText = true
+
+	ef := logging.Middleware()(func(Context) {
+		panic("boom")
+	})
+	upd := userMessage(1, 10, "hi")
+	assert.PanicsWithValue(t, "boom", func() {
+		ef(&NativeContext{upd: &upd})
+	})
+
+	require.Len(t, records, 1)
+	assert.EqualError(t, records[0].Err, "panic: boom")
+	assert.Equal(t, "hi", records[0].Text)
+}
+
+func TestStdLogger(t *testing.T) {
+	var buf bytes.Buffer
+	StdLogger(log.New(&buf, "", 0)).Log(LogRecord{
+		Kind:   LogKindAPI,
+		Method: "sendMessage",
+		ChatID: 1,
+		Text:   redacted,
+		Err:    errors.New("failed"),
+	})
+	assert.Equal(t, "api chat=1 method=sendMessage text=\"[redacted]\" duration=0s error=\"failed\"\n", buf.String())
+}
@@ -0,0 +1,322 @@
+package telestage
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// MenuState holds the settings a user chose in menus, by key.
+type MenuState map[string]string
+
+// Bool reports whether the checkbox with the key is checked.
+func (s MenuState) Bool(key string) bool {
+	return s[key] == "1"
+}
+
+// MenuStore persists the menu state of users.
+type MenuStore interface {
+	LoadMenuState(userID int64) (MenuState, error)
+	SaveMenuState(userID int64, state MenuState) error
+}
+
+// MemoryMenuStore is an in-memory MenuStore.
+type MemoryMenuStore struct {
+	lock   sync.Mutex
+	states map[int64]MenuState
+}
+
+func NewMemoryMenuStore() *MemoryMenuStore {
+	return &MemoryMenuStore{states: map[int64]MenuState{}}
+}
+
+func (s *MemoryMenuStore) LoadMenuState(userID int64) (MenuState, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	state := MenuState{}
+	for k, v := range s.states[userID] {
+		state[k] = v
+	}
+	return state, nil
+}
+
+func (s *MemoryMenuStore) SaveMenuState(userID int64, state MenuState) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.states[userID] = state
+	return nil
+}
+
+type menuItemKind int
+
+const (
+	menuButton menuItemKind = iota
+	menuSubmenu
+	menuCheckbox
+	menuRadio
+)
+
+type menuItem struct {
+	kind      menuItemKind
+	label     string
+	labelFunc func(Context) string
+	// newRow is set when the item starts a row
+	newRow bool
+
+	handler EventFn
+	submenu *Menu
+	// key and value of the setting of checkboxes and radio buttons
+	key, value string
+}
+
+// Menu is a message with an inline keyboard, whose buttons open submenus,
+// toggle settings or call handlers. Navigation edits the same message.
+// Settings are kept per user in the Store of the root menu.
+type Menu struct {
+	// Store keeps the settings of the menu tree, used from the root menu.
+	// An in-memory store by default.
+	Store MenuStore
+	// BackLabel is the label of the button returning from a submenu to its parent.
+	BackLabel string
+	// OnError, if set, is called when the menu fails to render or to be edited.
+	OnError func(Context, error)
+
+	id       string
+	text     func(Context) string
+	columns  int
+	items    []menuItem
+	parent   *Menu
+	breakRow bool
+	route    *CallbackRoute
+}
+
+// NewMenu creates a menu with the text. The id identifies the menu in
+// callback data, so it must be short and unique within the menu tree.
+func NewMenu(id, text string) *Menu {
+	return &Menu{
+		Store:     NewMemoryMenuStore(),
+		BackLabel: "« Back",
+		id:        id,
+		text:      func(Context) string { return text },
+		columns:   1,
+		route:     NewCallbackRoute(id + ":{menu}:{item}"),
+	}
+}
+
+// TextFunc computes the text of the menu on every render.
+func (m *Menu) TextFunc(f func(Context) string) *Menu {
+	m.text = f
+	return m
+}
+
+// Columns sets the number of buttons in a row.
+func (m *Menu) Columns(n int) *Menu {
+	m.columns = n
+	return m
+}
+
+// Row starts a new row of buttons.
+func (m *Menu) Row() *Menu {
+	m.breakRow = true
+	return m
+}
+
+// Button adds a button calling the handler.
+func (m *Menu) Button(label string, h EventFn) *Menu {
+	return m.add(menuItem{kind: menuButton, label: label, handler: h})
+}
+
+// ButtonFunc adds a button calling the handler, with the label computed on every render.
+func (m *Menu) ButtonFunc(label func(Context) string, h EventFn) *Menu {
+	return m.add(menuItem{kind: menuButton, labelFunc: label, handler: h})
+}
+
+// Submenu adds a button opening the submenu, which gets a button back to m.
+func (m *Menu) Submenu(label string, sub *Menu) *Menu {
+	sub.parent = m
+	return m.add(menuItem{kind: menuSubmenu, label: label, submenu: sub})
+}
+
+// Checkbox adds a button toggling the setting with the key.
+func (m *Menu) Checkbox(label, key string) *Menu {
+	return m.add(menuItem{kind: menuCheckbox, label: label, key: key})
+}
+
+// Radio adds a button setting the key to the value. Radio buttons with the
+// same key make a group with a single selected value.
+func (m *Menu) Radio(label, key, value string) *Menu {
+	return m.add(menuItem{kind: menuRadio, label: label, key: key, value: value})
+}
+
+func (m *Menu) add(item menuItem) *Menu {
+	item.newRow = m.breakRow
+	m.breakRow = false
+	m.items = append(m.items, item)
+	return m
+}
+
+func (m *Menu) root() *Menu {
+	for m.parent != nil {
+		m = m.parent
+	}
+	return m
+}
+
+// menus returns the menus of the tree starting with m by id
+func (m *Menu) menus(all map[string]*Menu) map[string]*Menu {
+	all[m.id] = m
+	for _, item := range m.items {
+		if item.submenu != nil {
+			item.submenu.menus(all)
+		}
+	}
+	return all
+}
+
+// Register handles the callbacks of the menu tree in the scene. It must be
+// called on the root menu after the tree is built.
+func (m *Menu) Register(s *Scene, mw ...Middleware) {
+	menus := m.menus(map[string]*Menu{})
+	s.OnCallback(m.route, func(ctx Context) {
+		menu, ok := menus[CallbackParam(ctx, "menu")]
+		if !ok {
+			answerCallback(ctx)
+			return
+		}
+		menu.press(ctx, CallbackParam(ctx, "item"))
+	}, mw...)
+}
+
+// State returns the settings of the user of the context.
+func (m *Menu) State(ctx Context) (MenuState, error) {
+	return m.root().Store.LoadMenuState(ctx.Sender().ID)
+}
+
+// Send sends the menu to the chat.
+func (m *Menu) Send(ctx Context, opts ...SendOption) (tgbotapi.Message, error) {
+	text, markup, err := m.Render(ctx)
+	if err != nil {
+		return tgbotapi.Message{}, err
+	}
+	return ctx.Send(text, append(opts, WithMarkup(markup))...)
+}
+
+// Render returns the text and the keyboard of the menu for the user of the context.
+func (m *Menu) Render(ctx Context) (string, tgbotapi.InlineKeyboardMarkup, error) {
+	state, err := m.State(ctx)
+	if err != nil {
+		return "", tgbotapi.InlineKeyboardMarkup{}, err
+	}
+
+	route := m.root().route
+	kb := NewInlineKeyboard().Columns(m.columns)
+	for i, item := range m.items {
+		if item.newRow {
+			kb.Row()
+		}
+		kb.Callback(item.render(ctx, state), route, m.id, i)
+	}
+	if m.parent != nil {
+		kb.Row().Callback(m.BackLabel, route, m.id, "back")
+	}
+
+	markup, err := kb.Build()
+	return m.text(ctx), markup, err
+}
+
+func (item menuItem) render(ctx Context, state MenuState) string {
+	label := item.label
+	if item.labelFunc != nil {
+		label = item.labelFunc(ctx)
+	}
+
+	switch item.kind {
+	case menuCheckbox:
+		if state.Bool(item.key) {
+			return "✅ " + label
+		}
+		return "⬜ " + label
+	case menuRadio:
+		if state[item.key] == item.value {
+			return "🔘 " + label
+		}
+		return "⚪ " + label
+	default:
+		return label
+	}
+}
+
+// press handles the button of the menu. The query is answered unless the
+// button handler already did.
+func (m *Menu) press(ctx Context, button string) {
+	defer answerCallback(ctx)
+
+	if button == "back" {
+		if m.parent != nil {
+			m.parent.show(ctx)
+		}
+		return
+	}
+
+	i, err := strconv.Atoi(button)
+	if err != nil || i < 0 || i >= len(m.items) {
+		return
+	}
+
+	item := m.items[i]
+	switch item.kind {
+	case menuButton:
+		if item.handler != nil {
+			item.handler(ctx)
+		}
+	case menuSubmenu:
+		item.submenu.show(ctx)
+	case menuCheckbox, menuRadio:
+		if err := m.set(ctx, item); err != nil {
+			m.fail(ctx, err)
+			return
+		}
+		m.show(ctx)
+	}
+}
+
+// set saves the setting of the checkbox or the radio button
+func (m *Menu) set(ctx Context, item menuItem) error {
+	state, err := m.State(ctx)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case item.kind == menuRadio:
+		state[item.key] = item.value
+	case state.Bool(item.key):
+		delete(state, item.key)
+	default:
+		state[item.key] = "1"
+	}
+	return m.root().Store.SaveMenuState(ctx.Sender().ID, state)
+}
+
+// show edits the message of the callback into the menu
+func (m *Menu) show(ctx Context) {
+	defer answerCallback(ctx)
+
+	text, markup, err := m.Render(ctx)
+	if err == nil {
+		_, err = ctx.Edit(text, WithMarkup(markup))
+	}
+	if err != nil {
+		m.fail(ctx, fmt.Errorf("menu %s: %w", m.id, err))
+	}
+}
+
+func (m *Menu) fail(ctx Context, err error) {
+	if onError := m.root().OnError; onError != nil {
+		onError(ctx, err)
+	}
+}
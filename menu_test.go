@@ -0,0 +1,81 @@
+package telestage
+
+import (
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMenu(t *testing.T) {
+	srv, bot := newTestBot(t)
+
+	called := false
+	settings := NewMenu("settings", "Settings").
+		Checkbox("Notifications", "notify").
+		Row().
+		Radio("English", "lang", "en").
+		Radio("Ukrainian", "lang", "uk")
+	root := NewMenu("main", "Main menu").
+		Submenu("Settings", settings).
+		ButtonFunc(func(ctx Context) string { return "Hi, " + ctx.Sender().FirstName }, func(ctx Context) {
+			called = true
+		})
+
+	var menu tgbotapi.Message
+	s := NewScene()
+	s.OnMessage(func(ctx Context) {
+		var err error
+		menu, err = root.Send(ctx)
+		require.NoError(t, err)
+	})
+	root.Register(s)
+	stage := NewStage(emptyStateGetter)
+	stage.Add("", s)
+
+	user := &tgbotapi.User{ID: 1, FirstName: "Ann"}
+	require.NoError(t, stage.Run(bot, tgbotapi.Update{Message: &tgbotapi.Message{
+		From: user,
+		Chat: &tgbotapi.Chat{ID: 1, Type: "private"},
+	}}))
+	press := func(data string) tgbotapi.Message {
+		require.NoError(t, stage.Run(bot, tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+			ID:      "q",
+			From:    user,
+			Message: &menu,
+			Data:    data,
+		}}))
+		m, ok := srv.Message(1, menu.MessageID)
+		require.True(t, ok)
+		return m
+	}
+	labels := func(m tgbotapi.Message) [][]string {
+		return rowLabels(m.ReplyMarkup.InlineKeyboard)
+	}
+
+	m := press("main:main:0")
+	assert.Equal(t, "Settings", m.Text, "submenu must be shown in the same message")
+	assert.Equal(t, [][]string{{"⬜ Notifications"}, {"⚪ English"}, {"⚪ Ukrainian"}, {"« Back"}}, labels(m))
+
+	press("main:settings:0")
+	m = press("main:settings:2")
+	assert.Equal(t, [][]string{{"✅ Notifications"}, {"⚪ English"}, {"🔘 Ukrainian"}, {"« Back"}}, labels(m))
+
+	state, err := root.State(&NativeContext{upd: &tgbotapi.Update{Message: &tgbotapi.Message{From: user}}})
+	require.NoError(t, err)
+	assert.True(t, state.Bool("notify"))
+	assert.Equal(t, "uk", state["lang"])
+
+	m = press("main:settings:back")
+	assert.Equal(t, "Main menu", m.Text)
+	assert.Equal(t, [][]string{{"Settings"}, {"Hi, Ann"}}, labels(m))
+
+	answered := len(srv.CallsTo("answerCallbackQuery"))
+	press("main:main:1")
+	assert.True(t, called)
+	assert.Len(t, srv.CallsTo("answerCallbackQuery"), answered+1, "button press must answer the query")
+
+	press("main:main:0")
+	assert.Len(t, srv.CallsTo("answerCallbackQuery"), answered+2, "submenu must be answered once")
+}
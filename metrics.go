@@ -0,0 +1,246 @@
+package telestage
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// DefaultBuckets are the upper bounds of latency histograms in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Metrics collects counters and histograms of the stage and outgoing calls,
+// and serves them in the Prometheus text format:
+//
+//	stg.Observe(metrics.Observer())
+//	stg.UseClient(metrics.Client())
+//	http.Handle("/metrics", metrics)
+type Metrics struct {
+	// Buckets of the latency histograms, DefaultBuckets if empty.
+	Buckets []float64
+
+	lock           sync.Mutex
+	updates        *metricVec
+	unhandled      *metricVec
+	errors         *metricVec
+	handlerLatency *metricVec
+	apiCalls       *metricVec
+	apiLatency     *metricVec
+	limiters       map[string]*RateLimiter
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		updates:        newMetricVec("telestage_updates_total", "counter", "Updates handled by type, scene and route.", "type", "scene", "route"),
+		unhandled:      newMetricVec("telestage_unhandled_updates_total", "counter", "Updates no route matched by type and scene.", "type", "scene"),
+		errors:         newMetricVec("telestage_update_errors_total", "counter", "Updates failed by scene and reason (error or panic).", "scene", "reason"),
+		handlerLatency: newMetricVec("telestage_handler_duration_seconds", "histogram", "Duration of update handling by scene and route.", "scene", "route"),
+		apiCalls:       newMetricVec("telestage_api_requests_total", "counter", "Bot API requests by method and status.", "method", "status"),
+		apiLatency:     newMetricVec("telestage_api_request_duration_seconds", "histogram", "Duration of Bot API requests by method.", "method"),
+		limiters:       map[string]*RateLimiter{},
+	}
+}
+
+// Observer returns the UpdateObserver to add with Stage.Observe.
+func (m *Metrics) Observer() UpdateObserver {
+	return func(ctx Context, info UpdateInfo) {
+		m.lock.Lock()
+		defer m.lock.Unlock()
+
+		typ := UpdateType(ctx.Upd())
+		switch {
+		case info.Handled():
+			m.updates.add(1, typ, info.Scene, info.Route)
+			m.handlerLatency.observe(m.buckets(), info.Duration.Seconds(), info.Scene, info.Route)
+		case info.Err == nil && info.Panic == nil:
+			m.unhandled.add(1, typ, info.Scene)
+		}
+		if info.Panic != nil {
+			m.errors.add(1, info.Scene, "panic")
+		} else if info.Err != nil {
+			m.errors.add(1, info.Scene, "error")
+		}
+	}
+}
+
+// Client counts outgoing Bot API requests by method and status: the HTTP
+// status code, which is the error code for failed requests, or "error" if
+// the request failed without a response.
+func (m *Metrics) Client() ClientMiddleware {
+	return func(next tgbotapi.HTTPClient) tgbotapi.HTTPClient {
+		return ClientFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next.Do(req)
+
+			status := "error"
+			if err == nil {
+				status = strconv.Itoa(resp.StatusCode)
+			}
+			method := apiMethod(req)
+
+			m.lock.Lock()
+			m.apiCalls.add(1, method, status)
+			m.apiLatency.observe(m.buckets(), time.Since(start).Seconds(), method)
+			m.lock.Unlock()
+
+			return resp, err
+		})
+	}
+}
+
+// WatchRateLimiter exports the queue depth and the sent messages of the limiter with the name.
+func (m *Metrics) WatchRateLimiter(name string, l *RateLimiter) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.limiters[name] = l
+}
+
+func (m *Metrics) buckets() []float64 {
+	if len(m.Buckets) > 0 {
+		return m.Buckets
+	}
+	return DefaultBuckets
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = m.Write(w)
+}
+
+// Write writes the metrics in the Prometheus text format.
+func (m *Metrics) Write(w io.Writer) error {
+	m.lock.Lock()
+	var b strings.Builder
+	for _, v := range []*metricVec{m.updates, m.unhandled, m.errors, m.handlerLatency, m.apiCalls, m.apiLatency} {
+		v.write(&b, m.buckets())
+	}
+	limiters := make(map[string]*RateLimiter, len(m.limiters))
+	for name, l := range m.limiters {
+		limiters[name] = l
+	}
+	m.lock.Unlock()
+
+	if len(limiters) > 0 {
+		queued := newMetricVec("telestage_ratelimiter_queue_depth", "gauge", "Messages waiting in the rate limiter by priority.", "limiter", "priority")
+		sent := newMetricVec("telestage_ratelimiter_sent_total", "counter", "Messages let through by the rate limiter.", "limiter")
+		for name, l := range limiters {
+			stats := l.Stats()
+			queued.add(float64(stats.Queued[PriorityInteractive]), name, "interactive")
+			queued.add(float64(stats.Queued[PriorityBulk]), name, "bulk")
+			sent.add(float64(stats.Sent), name)
+		}
+		queued.write(&b, nil)
+		sent.write(&b, nil)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// metricVec is a metric with labels, a counter, a gauge or a histogram
+type metricVec struct {
+	name, typ, help string
+	labels          []string
+	series          map[string]*series
+}
+
+type series struct {
+	labels []string
+	value  float64
+	// counts of the histogram by bucket, not cumulative
+	counts []uint64
+	count  uint64
+}
+
+func newMetricVec(name, typ, help string, labels ...string) *metricVec {
+	return &metricVec{name: name, typ: typ, help: help, labels: labels, series: map[string]*series{}}
+}
+
+func (v *metricVec) get(labels []string) *series {
+	key := strings.Join(labels, "\xff")
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{labels: labels}
+		v.series[key] = s
+	}
+	return s
+}
+
+func (v *metricVec) add(n float64, labels ...string) {
+	v.get(labels).value += n
+}
+
+func (v *metricVec) observe(buckets []float64, x float64, labels ...string) {
+	s := v.get(labels)
+	if s.counts == nil {
+		s.counts = make([]uint64, len(buckets))
+	}
+	for i, le := range buckets {
+		if x <= le {
+			s.counts[i]++
+			break
+		}
+	}
+	s.value += x
+	s.count++
+}
+
+func (v *metricVec) write(w io.Writer, buckets []float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.name, v.help, v.name, v.typ)
+
+	keys := make([]string, 0, len(v.series))
+	for k := range v.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		s := v.series[k]
+		labels := formatLabels(v.labels, s.labels)
+		if v.typ != "histogram" {
+			fmt.Fprintf(w, "%s%s %s\n", v.name, labels, formatFloat(s.value))
+			continue
+		}
+
+		leNames := append(append([]string{}, v.labels...), "le")
+		bucket := func(le string) string {
+			return formatLabels(leNames, append(append([]string{}, s.labels...), le))
+		}
+		var cumulative uint64
+		for i, le := range buckets {
+			if i < len(s.counts) {
+				cumulative += s.counts[i]
+			}
+			fmt.Fprintf(w, "%s_bucket%s %d\n", v.name, bucket(formatFloat(le)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", v.name, bucket("+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", v.name, labels, formatFloat(s.value))
+		fmt.Fprintf(w, "%s_count%s %d\n", v.name, labels, s.count)
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, n := range names {
+		pairs[i] = n + `="` + labelEscaper.Replace(values[i]) + `"`
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
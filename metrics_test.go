@@ -0,0 +1,67 @@
+package telestage
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	srv, bot := newTestBot(t)
+	srv.FailNext("sendMessage", 429, "Too Many Requests: retry after 1", 1)
+
+	metrics := NewMetrics()
+	metrics.Buckets = []float64{1}
+	limiter := NewRateLimiter(DefaultRateLimits)
+	defer limiter.Stop()
+	metrics.WatchRateLimiter("main", limiter)
+
+	s := NewScene()
+	s.OnCommand("start", func(ctx Context) {
+		ctx.Reply("hi")
+		ctx.Reply("hi")
+	})
+	s.OnCommand("panic", func(ctx Context) {
+		panic("boom")
+	})
+	stage := NewStage(func(Context) string { return "main" })
+	stage.Add("main", s)
+	stage.Observe(metrics.Observer())
+	stage.UseClient(metrics.Client())
+
+	command := func(cmd string) tgbotapi.Update {
+		upd := userMessage(1, 10, "/"+cmd)
+		upd.Message.Entities = []tgbotapi.MessageEntity{{Type: "bot_command", Length: len(cmd) + 1}}
+		return upd
+	}
+	require.NoError(t, stage.Run(bot, command("start")))
+	require.NoError(t, stage.Run(bot, command("unknown")))
+	assert.Panics(t, func() { stage.Run(bot, command("panic")) })
+
+	rec := httptest.NewRecorder()
+	metrics.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(t, rec.Header().Get("Content-Type"), "text/plain")
+	body := rec.Body.String()
+
+	for _, line := range []string{
+		"# TYPE telestage_updates_total counter",
+		`telestage_updates_total{type="message",scene="main",route="command:start"} 1`,
+		`telestage_unhandled_updates_total{type="message",scene="main"} 1`,
+		`telestage_update_errors_total{scene="main",reason="panic"} 1`,
+		"# TYPE telestage_handler_duration_seconds histogram",
+		`telestage_handler_duration_seconds_bucket{scene="main",route="command:start",le="1"} 1`,
+		`telestage_handler_duration_seconds_bucket{scene="main",route="command:start",le="+Inf"} 1`,
+		`telestage_handler_duration_seconds_count{scene="main",route="command:start"} 1`,
+		`telestage_api_requests_total{method="sendMessage",status="200"} 1`,
+		`telestage_api_requests_total{method="sendMessage",status="429"} 1`,
+		`telestage_api_request_duration_seconds_count{method="sendMessage"} 2`,
+		`telestage_ratelimiter_queue_depth{limiter="main",priority="bulk"} 0`,
+		`telestage_ratelimiter_sent_total{limiter="main"} 0`,
+	} {
+		assert.Contains(t, strings.Split(body, "\n"), line)
+	}
+}
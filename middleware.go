@@ -3,8 +3,15 @@ package telestage
 type Middleware func(EventFn) EventFn
 
 func applyMiddleware(ef EventFn, middleware ...Middleware) EventFn {
+	ef = traced(func(ctx Context) string { return "handler " + RouteName(ctx) }, ef)
+	return chainMiddleware(ef, middleware...)
+}
+
+// chainMiddleware wraps ef with the middleware, the first one is the outermost
+func chainMiddleware(ef EventFn, middleware ...Middleware) EventFn {
 	for i := len(middleware) - 1; i >= 0; i-- {
-		ef = middleware[i](ef)
+		name := "middleware " + middlewareName(middleware[i])
+		ef = traced(func(Context) string { return name }, middleware[i](ef))
 	}
 	return ef
 }
@@ -0,0 +1,253 @@
+package telestage
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// PageItem is an item of a paginated list, shown as a button with the label.
+type PageItem struct {
+	ID    string
+	Label string
+	// Value is an arbitrary payload passed to Paginator.OnSelect.
+	Value interface{}
+}
+
+// PageSource provides the items of a paginated list.
+type PageSource interface {
+	Count(ctx Context) (int, error)
+	Page(ctx Context, offset, limit int) ([]PageItem, error)
+}
+
+type slicePages []PageItem
+
+func (s slicePages) Count(Context) (int, error) {
+	return len(s), nil
+}
+
+func (s slicePages) Page(_ Context, offset, limit int) ([]PageItem, error) {
+	if offset > len(s) {
+		offset = len(s)
+	}
+	if offset+limit > len(s) {
+		limit = len(s) - offset
+	}
+	return s[offset : offset+limit], nil
+}
+
+// SlicePages is a PageSource over the items.
+func SlicePages(items []PageItem) PageSource {
+	return slicePages(items)
+}
+
+// Paginator shows a list page by page in a message with an inline keyboard:
+// a button per item and numbered page buttons below. Page buttons edit the
+// message in place.
+type Paginator struct {
+	Source PageSource
+	// PageSize is the number of items on a page, 5 by default.
+	PageSize int
+	// Columns is the number of item buttons in a row, 1 by default.
+	Columns int
+	// NavButtons is the number of numbered page buttons, 5 by default.
+	NavButtons int
+	// Text returns the text of the message, "Page 1 of 3" by default.
+	Text func(ctx Context, page, pages int) string
+	// OnSelect, if set, is called when an item button is pressed.
+	OnSelect func(ctx Context, item PageItem)
+	// OnError, if set, is called when a page fails to render or to be edited.
+	OnError func(Context, error)
+
+	pageRoute   *CallbackRoute
+	selectRoute *CallbackRoute
+}
+
+// NewPaginator creates a paginator of the source. The name prefixes the
+// callback data of its buttons and must be unique within the scene.
+func NewPaginator(name string, source PageSource) *Paginator {
+	return &Paginator{
+		Source:      source,
+		PageSize:    5,
+		Columns:     1,
+		NavButtons:  5,
+		pageRoute:   NewCallbackRoute(name + ":p:{page}"),
+		selectRoute: NewCallbackRoute(name + ":s:{page}:{id}"),
+	}
+}
+
+// Register handles the callbacks of the paginator buttons in the scene.
+func (p *Paginator) Register(s *Scene, mw ...Middleware) {
+	s.OnCallback(p.pageRoute, p.onPage, mw...)
+	s.OnCallback(p.selectRoute, p.onSelect, mw...)
+}
+
+// Send sends the first page to the chat.
+func (p *Paginator) Send(ctx Context, opts ...SendOption) (tgbotapi.Message, error) {
+	text, markup, err := p.Render(ctx, 1)
+	if err != nil {
+		return tgbotapi.Message{}, err
+	}
+	return ctx.Send(text, append(opts, WithMarkup(markup))...)
+}
+
+// Render returns the text and the keyboard of the page, counting from 1.
+// The page is clamped to the existing ones.
+func (p *Paginator) Render(ctx Context, page int) (string, tgbotapi.InlineKeyboardMarkup, error) {
+	size := p.pageSize()
+	count, err := p.Source.Count(ctx)
+	if err != nil {
+		return "", tgbotapi.InlineKeyboardMarkup{}, err
+	}
+	pages := (count + size - 1) / size
+	if pages < 1 {
+		pages = 1
+	}
+	if page < 1 {
+		page = 1
+	}
+	if page > pages {
+		page = pages
+	}
+
+	items, err := p.Source.Page(ctx, (page-1)*size, size)
+	if err != nil {
+		return "", tgbotapi.InlineKeyboardMarkup{}, err
+	}
+
+	columns := p.Columns
+	if columns <= 0 {
+		columns = 1
+	}
+	kb := NewInlineKeyboard().Columns(columns)
+	for _, item := range items {
+		kb.Callback(item.Label, p.selectRoute, page, item.ID)
+	}
+	if pages > 1 {
+		kb.Row().Columns(MaxInlineRowButtons)
+		p.navigation(kb, page, pages)
+	}
+	markup, err := kb.Build()
+	if err != nil {
+		return "", markup, err
+	}
+
+	text := fmt.Sprintf("Page %d of %d", page, pages)
+	if p.Text != nil {
+		text = p.Text(ctx, page, pages)
+	}
+	return text, markup, nil
+}
+
+// navigation adds the numbered buttons of the pages around the current one,
+// and of the first and the last page when they are out of the window.
+func (p *Paginator) navigation(kb *InlineKeyboard, page, pages int) {
+	window := p.NavButtons
+	if window <= 0 {
+		window = 5
+	}
+	first := page - window/2
+	if first > pages-window+1 {
+		first = pages - window + 1
+	}
+	if first < 1 {
+		first = 1
+	}
+	last := first + window - 1
+	if last > pages {
+		last = pages
+	}
+
+	if first > 1 {
+		kb.Callback("« 1", p.pageRoute, 1)
+	}
+	for n := first; n <= last; n++ {
+		label := strconv.Itoa(n)
+		if n == page {
+			label = "· " + label + " ·"
+		}
+		kb.Callback(label, p.pageRoute, n)
+	}
+	if last < pages {
+		kb.Callback(strconv.Itoa(pages)+" »", p.pageRoute, pages)
+	}
+}
+
+func (p *Paginator) onPage(ctx Context) {
+	defer answerCallback(ctx)
+
+	page, _ := strconv.Atoi(CallbackParam(ctx, "page"))
+	text, markup, err := p.Render(ctx, page)
+	if err == nil {
+		_, err = ctx.Edit(text, WithMarkup(markup))
+	}
+	if err != nil && p.OnError != nil {
+		p.OnError(ctx, err)
+	}
+}
+
+func (p *Paginator) onSelect(ctx Context) {
+	defer answerCallback(ctx)
+	if p.OnSelect == nil {
+		return
+	}
+
+	id := CallbackParam(ctx, "id")
+	item := PageItem{ID: id}
+	size := p.pageSize()
+	page, _ := strconv.Atoi(CallbackParam(ctx, "page"))
+	if page < 1 {
+		page = 1
+	}
+	// the item is looked up on its page, so OnSelect gets its label and value
+	items, err := p.Source.Page(ctx, (page-1)*size, size)
+	if err != nil && p.OnError != nil {
+		p.OnError(ctx, err)
+	}
+	for _, it := range items {
+		if it.ID == id {
+			item = it
+			break
+		}
+	}
+
+	p.OnSelect(ctx, item)
+}
+
+func (p *Paginator) pageSize() int {
+	if p.PageSize <= 0 {
+		return 5
+	}
+	return p.PageSize
+}
+
+// answerCallback stops the loading indicator of the pressed button, unless
+// the query was already answered, e.g. by the user handler
+func answerCallback(ctx Context) {
+	if q := ctx.Upd().CallbackQuery; q != nil && !callbackAnswered(ctx) {
+		_, _ = ctx.Bot().Request(tgbotapi.NewCallback(q.ID, ""))
+	}
+}
+
+const callbackAnsweredKey = "telestage.callback_answered"
+
+func callbackAnswered(ctx Context) bool {
+	answered, _ := ctx.Get(callbackAnsweredKey).(bool)
+	return answered
+}
+
+// trackAnswer marks the callback query of the context answered once the
+// answerCallbackQuery method is called
+func trackAnswer(ctx Context) ClientMiddleware {
+	return func(next tgbotapi.HTTPClient) tgbotapi.HTTPClient {
+		return ClientFunc(func(req *http.Request) (*http.Response, error) {
+			resp, err := next.Do(req)
+			if err == nil && apiMethod(req) == "answerCallbackQuery" {
+				ctx.Set(callbackAnsweredKey, true)
+			}
+			return resp, err
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package telestage
+
+import (
+	"strconv"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testPageItems(n int) []PageItem {
+	items := make([]PageItem, n)
+	for i := range items {
+		id := strconv.Itoa(i + 1)
+		items[i] = PageItem{ID: id, Label: "item " + id, Value: i + 1}
+	}
+	return items
+}
+
+func navLabels(markup tgbotapi.InlineKeyboardMarkup) []string {
+	var labels []string
+	for _, b := range markup.InlineKeyboard[len(markup.InlineKeyboard)-1] {
+		labels = append(labels, b.Text)
+	}
+	return labels
+}
+
+func TestPaginator_Render(t *testing.T) {
+	p := NewPaginator("list", SlicePages(testPageItems(23)))
+	p.PageSize = 2
+	p.Columns = 2
+
+	text, markup, err := p.Render(&NativeContext{}, 6)
+	require.NoError(t, err)
+	assert.Equal(t, "Page 6 of 12", text)
+	assert.Equal(t, [][]string{{"item 11", "item 12"}}, rowLabels(markup.InlineKeyboard[:1]))
+	assert.Equal(t, "list:s:6:11", *markup.InlineKeyboard[0][0].CallbackData)
+	assert.Equal(t, []string{"« 1", "4", "5", "· 6 ·", "7", "8", "12 »"}, navLabels(markup))
+
+	_, markup, err = p.Render(&NativeContext{}, 100)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"« 1", "8", "9", "10", "11", "· 12 ·"}, navLabels(markup), "page must be clamped")
+
+	_, markup, err = NewPaginator("list", SlicePages(testPageItems(3))).Render(&NativeContext{}, 1)
+	require.NoError(t, err)
+	assert.Len(t, markup.InlineKeyboard, 3, "single page has no navigation")
+}
+
+func TestPaginator_Callbacks(t *testing.T) {
+	srv, bot := newTestBot(t)
+	p := NewPaginator("list", SlicePages(testPageItems(12)))
+	var selected PageItem
+	p.OnSelect = func(ctx Context, item PageItem) {
+		selected = item
+	}
+
+	var menu tgbotapi.Message
+	s := NewScene()
+	s.OnStart(func(ctx Context) {
+		var err error
+		menu, err = p.Send(ctx)
+		require.NoError(t, err)
+	})
+	p.Register(s)
+	stage := NewStage(emptyStateGetter)
+	stage.Add("", s)
+
+	start := userMessage(1, 1, "/start")
+	start.Message.Entities = []tgbotapi.MessageEntity{{Type: "bot_command", Length: 6}}
+	require.NoError(t, stage.Run(bot, start))
+
+	require.Len(t, srv.CallsTo("sendMessage"), 1)
+
+	press := func(data string) {
+		require.NoError(t, stage.Run(bot, tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+			ID:      "q",
+			From:    &tgbotapi.User{ID: 1},
+			Message: &menu,
+			Data:    data,
+		}}))
+	}
+
+	press("list:p:3")
+	m, _ := srv.Message(1, menu.MessageID)
+	assert.Equal(t, "Page 3 of 3", m.Text, "message must be edited in place")
+	assert.Len(t, srv.CallsTo("answerCallbackQuery"), 1)
+
+	press("list:s:3:12")
+	assert.Equal(t, PageItem{ID: "12", Label: "item 12", Value: 12}, selected)
+	assert.Len(t, srv.CallsTo("answerCallbackQuery"), 2, "select must answer the query")
+
+	p.OnSelect = func(ctx Context, item PageItem) {
+		ctx.Bot().Request(tgbotapi.NewCallback(ctx.Upd().CallbackQuery.ID, "Selected"))
+	}
+	press("list:s:3:11")
+	answers := srv.CallsTo("answerCallbackQuery")
+	require.Len(t, answers, 3, "query answered by OnSelect must not be answered again")
+	assert.Equal(t, "Selected", answers[2].Params.Get("text"))
+}
@@ -0,0 +1,367 @@
+package telestage
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+var (
+	ErrRateLimiterStopped = errors.New("rate limiter stopped")
+)
+
+// Priority of an outgoing message in the RateLimiter queue.
+type Priority int
+
+const (
+	// PriorityInteractive is used for replies to users, they are sent first.
+	PriorityInteractive Priority = iota
+	// PriorityBulk is used for mass sends, they use the capacity left by interactive replies.
+	PriorityBulk
+
+	priorities = 2
+)
+
+// Limit allows Count messages per period.
+// A zero Limit means no limit.
+type Limit struct {
+	Count int
+	Per   time.Duration
+}
+
+// RateLimits are the limits applied by RateLimiter.
+type RateLimits struct {
+	// Global is the limit of messages the bot sends to all chats.
+	Global Limit
+	// Private is the limit per private chat.
+	Private Limit
+	// Group is the limit per group, supergroup or channel.
+	Group Limit
+}
+
+// DefaultRateLimits are the limits documented by Telegram.
+// See https://core.telegram.org/bots/faq#my-bot-is-hitting-limits-how-do-i-avoid-this
+var DefaultRateLimits = RateLimits{
+	Global:  Limit{Count: 30, Per: time.Second},
+	Private: Limit{Count: 1, Per: time.Second},
+	Group:   Limit{Count: 20, Per: time.Minute},
+}
+
+// RateLimiterStats is a snapshot of RateLimiter state.
+type RateLimiterStats struct {
+	// Queued is the number of messages waiting to be sent by priority.
+	Queued [priorities]int
+	// Sent is the number of messages let through.
+	Sent uint64
+}
+
+// QueueDepth returns the total number of queued messages.
+func (s RateLimiterStats) QueueDepth() int {
+	n := 0
+	for _, q := range s.Queued {
+		n += q
+	}
+	return n
+}
+
+// RateLimiter queues outgoing messages so they respect Telegram's global,
+// per-private-chat and per-group limits. Interactive messages take
+// precedence over bulk ones, and a message waiting for a busy chat does not
+// block messages to other chats.
+type RateLimiter struct {
+	limits RateLimits
+
+	lock    sync.Mutex
+	global  *bucket
+	chats   map[string]*bucket
+	queues  [priorities][]*ticket
+	sent    uint64
+	pruned  time.Time
+	started sync.Once
+	wake    chan struct{}
+	stop    chan struct{}
+	stopped sync.Once
+}
+
+type ticket struct {
+	chat    string
+	private bool
+	ready   chan struct{}
+}
+
+// NewRateLimiter creates a RateLimiter. It must be stopped with Stop when not used anymore.
+func NewRateLimiter(limits RateLimits) *RateLimiter {
+	return &RateLimiter{
+		limits: limits,
+		global: newBucket(limits.Global, time.Now()),
+		chats:  map[string]*bucket{},
+		wake:   make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+	}
+}
+
+// Middleware returns a ClientMiddleware which waits for the limiter before
+// sending messages with the priority. Requests other than sending
+// messages are passed through.
+func (rl *RateLimiter) Middleware(p Priority) ClientMiddleware {
+	return func(next tgbotapi.HTTPClient) tgbotapi.HTTPClient {
+		return ClientFunc(func(req *http.Request) (*http.Response, error) {
+			if !isMessageMethod(apiMethod(req)) {
+				return next.Do(req)
+			}
+
+			params, err := apiParams(req)
+			if err != nil {
+				return nil, err
+			}
+			if err := rl.Wait(req.Context(), params.Get("chat_id"), p); err != nil {
+				return nil, err
+			}
+
+			return next.Do(req)
+		})
+	}
+}
+
+// Wait blocks until a message to the chat may be sent. The chat is the
+// chat_id parameter of the request: a numeric ID or a channel username.
+func (rl *RateLimiter) Wait(ctx context.Context, chat string, p Priority) error {
+	if p < 0 || p >= priorities {
+		p = PriorityBulk
+	}
+	t := &ticket{
+		chat:    chat,
+		private: isPrivateChatID(chat),
+		ready:   make(chan struct{}),
+	}
+
+	rl.lock.Lock()
+	rl.queues[p] = append(rl.queues[p], t)
+	rl.lock.Unlock()
+
+	rl.started.Do(func() {
+		go rl.loop()
+	})
+	rl.signal()
+
+	select {
+	case <-t.ready:
+		return nil
+	case <-ctx.Done():
+		if !rl.cancel(t, p) {
+			// the ticket was dispatched in the meantime
+			return nil
+		}
+		return ctx.Err()
+	case <-rl.stop:
+		return ErrRateLimiterStopped
+	}
+}
+
+// Stats returns the current queue depth and counters.
+func (rl *RateLimiter) Stats() RateLimiterStats {
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+
+	var stats RateLimiterStats
+	for p, q := range rl.queues {
+		stats.Queued[p] = len(q)
+	}
+	stats.Sent = rl.sent
+
+	return stats
+}
+
+// Stop releases all waiting senders with ErrRateLimiterStopped.
+func (rl *RateLimiter) Stop() {
+	rl.stopped.Do(func() {
+		close(rl.stop)
+	})
+}
+
+func (rl *RateLimiter) signal() {
+	select {
+	case rl.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (rl *RateLimiter) cancel(t *ticket, p Priority) bool {
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+
+	for i, queued := range rl.queues[p] {
+		if queued == t {
+			rl.queues[p] = append(rl.queues[p][:i], rl.queues[p][i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (rl *RateLimiter) loop() {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		rl.lock.Lock()
+		next := rl.dispatch(time.Now())
+		rl.lock.Unlock()
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		if next > 0 {
+			timer.Reset(next)
+		}
+
+		select {
+		case <-rl.wake:
+		case <-timer.C:
+		case <-rl.stop:
+			return
+		}
+	}
+}
+
+// dispatch releases every ticket which can be sent now and returns the
+// delay until the next one can be, or zero if the queues are empty.
+func (rl *RateLimiter) dispatch(now time.Time) time.Duration {
+	var next time.Duration
+	wait := func(d time.Duration) {
+		if next == 0 || d < next {
+			next = d
+		}
+	}
+
+	for p := range rl.queues {
+		queue := rl.queues[p][:0]
+		for _, t := range rl.queues[p] {
+			if d := rl.global.delay(now); d > 0 {
+				wait(d)
+				queue = append(queue, t)
+				continue
+			}
+
+			b := rl.bucket(t, now)
+			if d := b.delay(now); d > 0 {
+				wait(d)
+				queue = append(queue, t)
+				continue
+			}
+
+			rl.global.take()
+			b.take()
+			rl.sent++
+			close(t.ready)
+		}
+		rl.queues[p] = queue
+	}
+
+	rl.prune(now)
+
+	return next
+}
+
+func (rl *RateLimiter) bucket(t *ticket, now time.Time) *bucket {
+	b, ok := rl.chats[t.chat]
+	if !ok {
+		limit := rl.limits.Group
+		if t.private {
+			limit = rl.limits.Private
+		}
+		b = newBucket(limit, now)
+		rl.chats[t.chat] = b
+	}
+	return b
+}
+
+// prune forgets idle chats: a full bucket behaves as a new one.
+func (rl *RateLimiter) prune(now time.Time) {
+	if now.Sub(rl.pruned) < time.Minute {
+		return
+	}
+	rl.pruned = now
+
+	for chat, b := range rl.chats {
+		if b.full(now) {
+			delete(rl.chats, chat)
+		}
+	}
+}
+
+// isMessageMethod reports whether the Bot API method sends a message to a chat.
+func isMessageMethod(method string) bool {
+	switch method {
+	case "sendChatAction":
+		return false
+	case "forwardMessage", "copyMessage":
+		return true
+	default:
+		return strings.HasPrefix(method, "send")
+	}
+}
+
+func isPrivateChatID(chat string) bool {
+	id, err := strconv.ParseInt(chat, 10, 64)
+	return err == nil && id > 0
+}
+
+// bucket is a token bucket refilled at Limit.Count tokens per Limit.Per.
+type bucket struct {
+	capacity float64
+	perSec   float64
+	tokens   float64
+	last     time.Time
+}
+
+func newBucket(l Limit, now time.Time) *bucket {
+	b := &bucket{last: now}
+	if l.Count > 0 && l.Per > 0 {
+		b.capacity = float64(l.Count)
+		b.perSec = float64(l.Count) / l.Per.Seconds()
+		b.tokens = b.capacity
+	}
+	return b
+}
+
+func (b *bucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * b.perSec
+		if b.tokens > b.capacity {
+			b.tokens = b.capacity
+		}
+	}
+	b.last = now
+}
+
+func (b *bucket) delay(now time.Time) time.Duration {
+	if b.perSec == 0 {
+		return 0
+	}
+	b.refill(now)
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.perSec * float64(time.Second))
+}
+
+func (b *bucket) take() {
+	if b.perSec > 0 {
+		b.tokens--
+	}
+}
+
+func (b *bucket) full(now time.Time) bool {
+	b.refill(now)
+	return b.tokens >= b.capacity
+}
@@ -0,0 +1,116 @@
+package telestage
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiter_PerChat(t *testing.T) {
+	rl := NewRateLimiter(RateLimits{
+		Private: Limit{Count: 1, Per: 50 * time.Millisecond},
+	})
+	defer rl.Stop()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		require.NoError(t, rl.Wait(context.Background(), "1", PriorityInteractive))
+	}
+	assert.GreaterOrEqual(t, int64(time.Since(start)), int64(90*time.Millisecond), "third message to a chat must wait for two periods")
+
+	start = time.Now()
+	require.NoError(t, rl.Wait(context.Background(), "2", PriorityInteractive))
+	assert.Less(t, int64(time.Since(start)), int64(40*time.Millisecond), "other chats must not wait")
+	assert.Equal(t, uint64(4), rl.Stats().Sent)
+}
+
+func TestRateLimiter_Priority(t *testing.T) {
+	rl := NewRateLimiter(RateLimits{
+		Global: Limit{Count: 1, Per: 30 * time.Millisecond},
+	})
+	defer rl.Stop()
+
+	// exhaust the global bucket
+	require.NoError(t, rl.Wait(context.Background(), "0", PriorityInteractive))
+
+	var lock sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+	send := func(chat string, p Priority) {
+		defer wg.Done()
+		require.NoError(t, rl.Wait(context.Background(), chat, p))
+		lock.Lock()
+		order = append(order, chat)
+		lock.Unlock()
+	}
+
+	wg.Add(2)
+	go send("bulk", PriorityBulk)
+	assert.Eventually(t, func() bool { return rl.Stats().Queued[PriorityBulk] == 1 }, time.Second, time.Millisecond)
+	go send("interactive", PriorityInteractive)
+	assert.Eventually(t, func() bool { return rl.Stats().QueueDepth() == 2 }, time.Second, time.Millisecond)
+	wg.Wait()
+
+	assert.Equal(t, []string{"interactive", "bulk"}, order, "interactive messages must be sent first")
+}
+
+func TestRateLimiter_Cancel(t *testing.T) {
+	rl := NewRateLimiter(RateLimits{
+		Group: Limit{Count: 1, Per: time.Hour},
+	})
+	defer rl.Stop()
+
+	require.NoError(t, rl.Wait(context.Background(), "-1", PriorityBulk))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, rl.Wait(ctx, "-1", PriorityBulk), context.DeadlineExceeded)
+	assert.Equal(t, 0, rl.Stats().QueueDepth(), "canceled message must leave the queue")
+}
+
+func TestRateLimiter_Stop(t *testing.T) {
+	rl := NewRateLimiter(RateLimits{
+		Group: Limit{Count: 1, Per: time.Hour},
+	})
+	require.NoError(t, rl.Wait(context.Background(), "-1", PriorityBulk))
+
+	go rl.Stop()
+	assert.ErrorIs(t, rl.Wait(context.Background(), "-1", PriorityBulk), ErrRateLimiterStopped)
+}
+
+func TestRateLimiter_Middleware(t *testing.T) {
+	rl := NewRateLimiter(RateLimits{
+		Private: Limit{Count: 1, Per: time.Hour},
+	})
+	defer rl.Stop()
+
+	var sent []string
+	client := rl.Middleware(PriorityInteractive)(ClientFunc(func(req *http.Request) (*http.Response, error) {
+		sent = append(sent, apiMethod(req))
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	}))
+
+	do := func(method, body string) error {
+		req, _ := http.NewRequest(http.MethodPost, "https://api.telegram.org/botTOKEN/"+method, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		_, err := client.Do(req)
+		return err
+	}
+
+	require.NoError(t, do("sendMessage", "chat_id=1&text=a"))
+	require.NoError(t, do("getMe", ""), "requests other than sending messages must pass")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, "https://api.telegram.org/botTOKEN/sendMessage", strings.NewReader("chat_id=1&text=b"))
+	_, err := client.Do(req)
+	assert.ErrorIs(t, err, context.DeadlineExceeded, "second message to the chat must wait")
+
+	assert.Equal(t, []string{"sendMessage", "getMe"}, sent)
+}
@@ -0,0 +1,188 @@
+package telestage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// RetryPolicy configures Retry.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one.
+	MaxAttempts int
+	// BaseDelay is the initial backoff delay for transient errors,
+	// doubled on every attempt and randomized (full jitter).
+	BaseDelay time.Duration
+	// MaxDelay caps the backoff delay. A retry_after longer than MaxDelay is
+	// not waited for, the error is returned instead.
+	MaxDelay time.Duration
+}
+
+// DefaultRetryPolicy is used by Retry for zero fields of the policy.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    time.Minute,
+}
+
+// sleep waits for d or until the context is done, replaced in tests.
+var sleep = func(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Retry returns a ClientMiddleware which retries failed Bot API requests:
+//
+//   - "Too Many Requests" (429) is retried for any method after the
+//     retry_after returned by Telegram, the request was not processed;
+//   - network errors which happened before the request was sent are retried
+//     for any method with jittered backoff;
+//   - other network errors and 5xx responses are retried only for
+//     idempotent methods (get*, set*, delete*, edit*), since a message may
+//     have been delivered already.
+//
+// Use it with Stage.UseClient to configure retries per Stage. Middleware
+// added after Retry (e.g. RateLimiter) runs on every attempt.
+func Retry(policy RetryPolicy) ClientMiddleware {
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = DefaultRetryPolicy.MaxAttempts
+	}
+	if policy.BaseDelay <= 0 {
+		policy.BaseDelay = DefaultRetryPolicy.BaseDelay
+	}
+	if policy.MaxDelay <= 0 {
+		policy.MaxDelay = DefaultRetryPolicy.MaxDelay
+	}
+
+	return func(next tgbotapi.HTTPClient) tgbotapi.HTTPClient {
+		return ClientFunc(func(req *http.Request) (*http.Response, error) {
+			if _, err := bufferBody(req); err != nil {
+				return nil, err
+			}
+			idempotent := isIdempotentMethod(apiMethod(req))
+
+			for attempt := 1; ; attempt++ {
+				attemptReq := req.Clone(req.Context())
+				if req.GetBody != nil {
+					attemptReq.Body, _ = req.GetBody()
+				}
+
+				resp, err := next.Do(attemptReq)
+				if attempt >= policy.MaxAttempts {
+					return resp, err
+				}
+
+				var delay time.Duration
+				switch {
+				case err != nil:
+					if !isUnsentError(err) && !(idempotent && isTransientError(err)) {
+						return resp, err
+					}
+					delay = policy.backoff(attempt)
+				default:
+					apiResp, peekErr := peekResponse(resp)
+					if peekErr != nil {
+						return resp, err
+					}
+					switch {
+					case apiResp.ErrorCode == http.StatusTooManyRequests:
+						delay = policy.backoff(attempt)
+						if apiResp.Parameters != nil && apiResp.Parameters.RetryAfter > 0 {
+							delay = time.Duration(apiResp.Parameters.RetryAfter) * time.Second
+						}
+						if delay > policy.MaxDelay {
+							return resp, err
+						}
+					case idempotent && (apiResp.ErrorCode >= 500 || resp.StatusCode >= 500):
+						delay = policy.backoff(attempt)
+					default:
+						return resp, err
+					}
+					resp.Body.Close()
+				}
+
+				if err := sleep(req.Context(), delay); err != nil {
+					return nil, err
+				}
+			}
+		})
+	}
+}
+
+// backoff returns a random delay up to BaseDelay*2^(attempt-1), capped by MaxDelay.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.BaseDelay << uint(attempt-1)
+	if d > p.MaxDelay || d <= 0 {
+		d = p.MaxDelay
+	}
+	return time.Duration(rand.Int63n(int64(d))) + 1
+}
+
+// RetryAfter reports how long Telegram asked to wait before retrying
+// the request which failed with err.
+func RetryAfter(err error) (time.Duration, bool) {
+	var apiErr *tgbotapi.Error
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+		return time.Duration(apiErr.RetryAfter) * time.Second, true
+	}
+	return 0, false
+}
+
+// peekResponse decodes the Bot API response and restores the body.
+func peekResponse(resp *http.Response) (tgbotapi.APIResponse, error) {
+	var apiResp tgbotapi.APIResponse
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return apiResp, err
+	}
+
+	err = json.Unmarshal(body, &apiResp)
+	return apiResp, err
+}
+
+func isIdempotentMethod(method string) bool {
+	for _, prefix := range []string{"get", "set", "delete", "edit"} {
+		if strings.HasPrefix(method, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isUnsentError reports whether the request failed before being sent,
+// so it is safe to retry for any method.
+func isUnsentError(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr)
+}
+
+func isTransientError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF)
+}
@@ -0,0 +1,180 @@
+package telestage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/askoldex/telestage/telestagetest"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func stubSleep(t *testing.T) *[]time.Duration {
+	var slept []time.Duration
+	original := sleep
+	sleep = func(_ context.Context, d time.Duration) error {
+		slept = append(slept, d)
+		return nil
+	}
+	t.Cleanup(func() { sleep = original })
+	return &slept
+}
+
+func jsonResponse(status int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: status,
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+}
+
+func doRetry(t *testing.T, policy RetryPolicy, method string, responses ...func() (*http.Response, error)) (*http.Response, error, []string) {
+	var bodies []string
+	client := Retry(policy)(ClientFunc(func(req *http.Request) (*http.Response, error) {
+		body, _ := io.ReadAll(req.Body)
+		bodies = append(bodies, string(body))
+		next := responses[0]
+		if len(responses) > 1 {
+			responses = responses[1:]
+		}
+		return next()
+	}))
+
+	req, err := http.NewRequest(http.MethodPost, "https://api.telegram.org/botTOKEN/"+method, strings.NewReader("chat_id=1&text=hi"))
+	require.NoError(t, err)
+	resp, err := client.Do(req)
+	return resp, err, bodies
+}
+
+func TestRetry_TooManyRequests(t *testing.T) {
+	slept := stubSleep(t)
+
+	resp, err, bodies := doRetry(t, RetryPolicy{}, "sendMessage",
+		func() (*http.Response, error) {
+			return jsonResponse(429, `{"ok":false,"error_code":429,"description":"Too Many Requests: retry after 3","parameters":{"retry_after":3}}`), nil
+		},
+		func() (*http.Response, error) {
+			return jsonResponse(200, `{"ok":true,"result":{}}`), nil
+		},
+	)
+
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, []time.Duration{3 * time.Second}, *slept, "retry_after must be honored")
+	assert.Equal(t, []string{"chat_id=1&text=hi", "chat_id=1&text=hi"}, bodies, "body must be resent")
+}
+
+func TestRetry_RetryAfterTooLong(t *testing.T) {
+	slept := stubSleep(t)
+
+	resp, err, bodies := doRetry(t, RetryPolicy{MaxDelay: time.Second}, "sendMessage",
+		func() (*http.Response, error) {
+			return jsonResponse(429, `{"ok":false,"error_code":429,"parameters":{"retry_after":30}}`), nil
+		},
+	)
+
+	require.NoError(t, err)
+	assert.Equal(t, 429, resp.StatusCode)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Contains(t, string(body), "retry_after", "response body must be kept")
+	assert.Empty(t, *slept)
+	assert.Len(t, bodies, 1)
+}
+
+func TestRetry_ServerError(t *testing.T) {
+	serverError := func() (*http.Response, error) {
+		return jsonResponse(502, `{"ok":false,"error_code":502,"description":"Bad Gateway"}`), nil
+	}
+
+	t.Run("idempotent method is retried", func(t *testing.T) {
+		slept := stubSleep(t)
+		_, _, bodies := doRetry(t, RetryPolicy{MaxAttempts: 3}, "getChat", serverError)
+		assert.Len(t, bodies, 3)
+		assert.Len(t, *slept, 2)
+	})
+
+	t.Run("sending is not retried", func(t *testing.T) {
+		stubSleep(t)
+		resp, _, bodies := doRetry(t, RetryPolicy{MaxAttempts: 3}, "sendMessage", serverError)
+		assert.Len(t, bodies, 1)
+		assert.Equal(t, 502, resp.StatusCode)
+	})
+}
+
+func TestRetry_NetworkError(t *testing.T) {
+	t.Run("unsent request is retried", func(t *testing.T) {
+		stubSleep(t)
+		_, err, bodies := doRetry(t, RetryPolicy{MaxAttempts: 2}, "sendMessage",
+			func() (*http.Response, error) {
+				return nil, &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+			},
+			func() (*http.Response, error) {
+				return jsonResponse(200, `{"ok":true}`), nil
+			},
+		)
+		assert.NoError(t, err)
+		assert.Len(t, bodies, 2)
+	})
+
+	t.Run("sent request is not retried", func(t *testing.T) {
+		stubSleep(t)
+		_, err, bodies := doRetry(t, RetryPolicy{MaxAttempts: 2}, "sendMessage",
+			func() (*http.Response, error) {
+				return nil, io.ErrUnexpectedEOF
+			},
+		)
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+		assert.Len(t, bodies, 1)
+	})
+}
+
+func TestRetry_Backoff(t *testing.T) {
+	p := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: 250 * time.Millisecond}
+	for attempt := 1; attempt <= 5; attempt++ {
+		d := p.backoff(attempt)
+		assert.Greater(t, int64(d), int64(0))
+		assert.LessOrEqual(t, int64(d), int64(250*time.Millisecond))
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	d, ok := RetryAfter(&tgbotapi.Error{Code: 429, ResponseParameters: tgbotapi.ResponseParameters{RetryAfter: 7}})
+	assert.True(t, ok)
+	assert.Equal(t, 7*time.Second, d)
+
+	_, ok = RetryAfter(errors.New("other"))
+	assert.False(t, ok)
+}
+
+func TestRetry_Stage(t *testing.T) {
+	slept := stubSleep(t)
+
+	srv := telestagetest.NewServer()
+	defer srv.Close()
+	bot, err := srv.Bot()
+	require.NoError(t, err)
+
+	var replyErr error
+	s := NewScene()
+	s.OnMessage(func(ctx Context) {
+		_, replyErr = ctx.Reply("hello")
+	})
+	stage := NewStage(emptyStateGetter)
+	stage.Add("", s)
+	stage.UseClient(Retry(RetryPolicy{}))
+
+	srv.FailNext("sendMessage", 429, "Too Many Requests: retry after 1", 1)
+	stage.Run(bot, tgbotapi.Update{
+		Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 1}},
+	})
+
+	assert.NoError(t, replyErr)
+	assert.Len(t, srv.CallsTo("sendMessage"), 2)
+	assert.Equal(t, []time.Duration{time.Second}, *slept)
+}
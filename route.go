@@ -0,0 +1,190 @@
+package telestage
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Kinds of routes.
+const (
+	RouteCommand  = "command"
+	RouteText     = "text"
+	RouteMessage  = "message"
+	RoutePhoto    = "photo"
+	RouteSticker  = "sticker"
+	RouteCallback = "callback"
+	// RouteCustom is the kind of routes added with Scene.On.
+	RouteCustom = "on"
+)
+
+// Route is a route of a scene, returned by the On* methods to describe it.
+type Route struct {
+	name    string
+	kind    string
+	pattern string
+	command string
+	// names of the scene and route middleware
+	middleware []string
+	// file:line of the registration
+	source string
+	// states the route moves users to
+	targets []string
+	// descriptions by language code, "" is the default one
+	descriptions map[string]string
+	scopes       []tgbotapi.BotCommandScope
+	usage        string
+	details      string
+	roles        []string
+}
+
+func newRoute(kind, pattern string, mw []Middleware) *Route {
+	r := &Route{name: kind, kind: kind, pattern: pattern, source: callerSource()}
+	if pattern != "" {
+		r.name = kind + ":" + pattern
+	}
+	if kind == RouteCommand {
+		r.command = pattern
+	}
+	for _, m := range mw {
+		r.middleware = append(r.middleware, middlewareName(m))
+	}
+	return r
+}
+
+// callerSource returns the location of the first caller outside of the package, or of a test of the package
+func callerSource() string {
+	pc := make([]uintptr, 16)
+	frames := runtime.CallersFrames(pc[:runtime.Callers(3, pc)])
+	for {
+		f, more := frames.Next()
+		pkg := f.Function
+		if i := strings.LastIndexByte(pkg, '/'); i >= 0 {
+			pkg = pkg[i+1:]
+		}
+		if !strings.HasPrefix(pkg, "telestage.") || strings.HasSuffix(f.File, "_test.go") || !more {
+			return fmt.Sprintf("%s:%d", f.File, f.Line)
+		}
+	}
+}
+
+// middlewareName returns the name of the middleware function without the package path
+func middlewareName(mw Middleware) string {
+	name := runtime.FuncForPC(reflect.ValueOf(mw).Pointer()).Name()
+	if i := strings.LastIndexByte(name, '/'); i >= 0 {
+		name = name[i+1:]
+	}
+	return name
+}
+
+// Name returns the name of the route, e.g. "command:start", see RouteName.
+func (r *Route) Name() string {
+	return r.name
+}
+
+// Kind returns the kind of the route, e.g. RouteCommand.
+func (r *Route) Kind() string {
+	return r.kind
+}
+
+// Pattern returns the command, the text or the callback pattern matched by the route.
+func (r *Route) Pattern() string {
+	return r.pattern
+}
+
+// Middleware returns the names of the scene and route middleware functions, outermost first.
+func (r *Route) Middleware() []string {
+	return r.middleware
+}
+
+// Source returns the file and line where the route was registered.
+func (r *Route) Source() string {
+	return r.source
+}
+
+// To declares the states of the scenes the route moves users to, they are
+// allowed transitions of the scene and the edges of the graph exported by
+// Stage.DOT and Stage.Mermaid.
+func (r *Route) To(states ...string) *Route {
+	r.targets = append(r.targets, states...)
+	return r
+}
+
+// Targets returns the states set with To.
+func (r *Route) Targets() []string {
+	return r.targets
+}
+
+// Command returns the command of the route, empty for routes other than commands.
+func (r *Route) Command() string {
+	return r.command
+}
+
+// Describe sets the description of the command, commands with descriptions
+// are published to Telegram by Stage.SyncCommands.
+func (r *Route) Describe(description string) *Route {
+	return r.DescribeIn("", description)
+}
+
+// DescribeIn sets the description of the command for users with the language code.
+func (r *Route) DescribeIn(lang, description string) *Route {
+	if r.descriptions == nil {
+		r.descriptions = map[string]string{}
+	}
+	r.descriptions[normalizeLocale(lang)] = description
+	return r
+}
+
+// Description returns the description of the command in the language,
+// falling back to the language without region and to the default description.
+func (r *Route) Description(lang string) string {
+	lang = normalizeLocale(lang)
+	for _, l := range []string{lang, baseLocale(lang), ""} {
+		if d, ok := r.descriptions[l]; ok {
+			return d
+		}
+	}
+	return ""
+}
+
+// Scope sets the scopes the command is published in, the default scope if none.
+func (r *Route) Scope(scopes ...tgbotapi.BotCommandScope) *Route {
+	r.scopes = scopes
+	return r
+}
+
+// Scopes returns the scopes the command is published in.
+func (r *Route) Scopes() []tgbotapi.BotCommandScope {
+	if len(r.scopes) == 0 {
+		return []tgbotapi.BotCommandScope{tgbotapi.NewBotCommandScopeDefault()}
+	}
+	return r.scopes
+}
+
+// Usage sets the arguments of the command shown by Help, e.g. "<user> [reason]".
+func (r *Route) Usage(args string) *Route {
+	r.usage = args
+	return r
+}
+
+// Details sets the text shown by Help for the command only, e.g. "/help ban".
+func (r *Route) Details(text string) *Route {
+	r.details = text
+	return r
+}
+
+// Roles sets the roles allowed to use the route, any of them is enough.
+// Help lists the command to senders with the roles only, and
+// AccessControl.RequireRouteRoles denies the route to the others.
+func (r *Route) Roles(roles ...string) *Route {
+	r.roles = roles
+	return r
+}
+
+// AllowedRoles returns the roles allowed to use the route, empty if the route is open to all.
+func (r *Route) AllowedRoles() []string {
+	return r.roles
+}
@@ -1,12 +1,17 @@
 package telestage
 
+const routeKey = "telestage.route"
+
 type EventFn func(Context)
 type Event func(Context) bool
 type EventDeterminant func(Context) bool
 
 type Scene struct {
 	events      []Event
+	routes      []*Route
 	middlewares []Middleware
+	transitions []string
+	after       []EventFn
 }
 
 func NewScene() *Scene {
@@ -17,6 +22,11 @@ func (s *Scene) GetEvents() []Event {
 	return s.events
 }
 
+// Routes returns the routes of the scene in the order they are matched.
+func (s *Scene) Routes() []*Route {
+	return s.routes
+}
+
 func (s *Scene) Use(mw ...Middleware) {
 	s.middlewares = append(s.middlewares, mw...)
 }
@@ -28,70 +38,96 @@ func (s *Scene) UseGroup(group func(*Scene), mw ...Middleware) {
 	s.middlewares = original
 }
 
-// OnCommand handle the command specified by first argument
-func (s *Scene) OnCommand(cmd string, ef EventFn, mw ...Middleware) {
-	ef = applyMiddleware(ef, append(s.middlewares, mw...)...)
+// handle adds the route of the kind, named kind:pattern, which is available to middleware with RouteName
+func (s *Scene) handle(kind, pattern string, match EventDeterminant, ef EventFn, mw []Middleware) *Route {
+	mw = append(append([]Middleware{}, s.middlewares...), mw...)
+	r := newRoute(kind, pattern, mw)
+	s.routes = append(s.routes, r)
+	ef = applyMiddleware(ef, mw...)
 	s.events = append(s.events, func(ctx Context) bool {
-		if ctx.Upd().Message == nil || ctx.Upd().Message.Command() != cmd {
+		if !match(ctx) {
 			return false
 		}
+		ctx.Set(routeKey, r)
 		ef(ctx)
-		return true
+		return s.finish(ctx)
 	})
+	return r
+}
+
+// OnCommand handle the command specified by first argument
+func (s *Scene) OnCommand(cmd string, ef EventFn, mw ...Middleware) *Route {
+	return s.handle(RouteCommand, cmd, func(ctx Context) bool {
+		return ctx.Upd().Message != nil && ctx.Upd().Message.Command() == cmd
+	}, ef, mw)
+}
+
+// OnText handle the text message equal to the text, e.g. the label of a reply keyboard button
+func (s *Scene) OnText(text string, ef EventFn, mw ...Middleware) *Route {
+	return s.handle(RouteText, text, func(ctx Context) bool {
+		return ctx.Upd().Message != nil && ctx.Upd().Message.Text == text
+	}, ef, mw)
 }
 
 // OnMessage handle any message type (photo, text, sticker etc.)
-func (s *Scene) OnMessage(ef EventFn, mw ...Middleware) {
-	ef = applyMiddleware(ef, append(s.middlewares, mw...)...)
-	s.events = append(s.events, func(ctx Context) bool {
-		if ctx.Upd().Message == nil {
-			return false
-		}
-		ef(ctx)
-		return true
-	})
+func (s *Scene) OnMessage(ef EventFn, mw ...Middleware) *Route {
+	return s.handle(RouteMessage, "", func(ctx Context) bool {
+		return ctx.Upd().Message != nil
+	}, ef, mw)
 }
 
 // OnPhoto handle sending a photo
-func (s *Scene) OnPhoto(ef EventFn, mw ...Middleware) {
-	ef = applyMiddleware(ef, append(s.middlewares, mw...)...)
-	s.events = append(s.events, func(ctx Context) bool {
+func (s *Scene) OnPhoto(ef EventFn, mw ...Middleware) *Route {
+	return s.handle(RoutePhoto, "", func(ctx Context) bool {
 		m := ctx.Message()
-		if m == nil || len(m.Photo) == 0 {
-			return false
-		}
-		ef(ctx)
-		return true
-	})
+		return m != nil && len(m.Photo) > 0
+	}, ef, mw)
 }
 
 // OnSticker handle sending a sticker
-func (s *Scene) OnSticker(ef EventFn, mw ...Middleware) {
-	ef = applyMiddleware(ef, append(s.middlewares, mw...)...)
-	s.events = append(s.events, func(ctx Context) bool {
+func (s *Scene) OnSticker(ef EventFn, mw ...Middleware) *Route {
+	return s.handle(RouteSticker, "", func(ctx Context) bool {
 		m := ctx.Message()
-		if m == nil || m.Sticker == nil {
+		return m != nil && m.Sticker != nil
+	}, ef, mw)
+}
+
+// OnCallback handle the callback query with data matching the route,
+// the route parameters are available with CallbackParam
+func (s *Scene) OnCallback(route *CallbackRoute, ef EventFn, mw ...Middleware) *Route {
+	return s.handle(RouteCallback, route.Pattern(), func(ctx Context) bool {
+		q := ctx.Upd().CallbackQuery
+		if q == nil {
 			return false
 		}
-		ef(ctx)
-		return true
-	})
+		params, ok := route.Match(q.Data)
+		if ok {
+			ctx.Set(callbackParamsKey, params)
+		}
+		return ok
+	}, ef, mw)
 }
 
 // OnPhoto handle the "/start" command
-func (s *Scene) OnStart(ef EventFn, mw ...Middleware) {
-	s.OnCommand("start", ef, mw...)
+func (s *Scene) OnStart(ef EventFn, mw ...Middleware) *Route {
+	return s.OnCommand("start", ef, mw...)
 }
 
 // On handle the your own event determinator
-func (s *Scene) On(determinant EventDeterminant, ef EventFn, mw ...Middleware) {
-	ef = applyMiddleware(ef, append(s.middlewares, mw...)...)
-	s.events = append(s.events, func(ctx Context) bool {
-		if !determinant(ctx) {
-			return false
-		}
-		ef(ctx)
+func (s *Scene) On(determinant EventDeterminant, ef EventFn, mw ...Middleware) *Route {
+	return s.handle(RouteCustom, "", determinant, ef, mw)
+}
 
-		return true
-	})
+// RouteName returns the name of the matched route, e.g. "command:start" or "callback:item:{id}".
+func RouteName(ctx Context) string {
+	if r := CurrentRoute(ctx); r != nil {
+		return r.name
+	}
+	return ""
+}
+
+// CurrentRoute returns the matched route.
+func CurrentRoute(ctx Context) *Route {
+	r, _ := ctx.Get(routeKey).(*Route)
+	return r
 }
@@ -252,3 +252,18 @@ func TestOwnEvent(t *testing.T) {
 	})
 	assert.True(t, invoked, "they should be true if message caption contains 'hello'")
 }
+
+func TestOnText(t *testing.T) {
+	invoked := false
+	s := NewScene()
+	s.OnText("Help", func(_ Context) {
+		invoked = true
+	})
+	stage := NewStage(emptyStateGetter)
+	stage.Add("", s)
+
+	stage.Run(&tgbotapi.BotAPI{}, tgbotapi.Update{Message: &tgbotapi.Message{Text: "help"}})
+	assert.False(t, invoked)
+	stage.Run(&tgbotapi.BotAPI{}, tgbotapi.Update{Message: &tgbotapi.Message{Text: "Help"}})
+	assert.True(t, invoked)
+}
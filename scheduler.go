@@ -0,0 +1,301 @@
+package telestage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+var (
+	ErrJobHandlerNotFound = errors.New("job handler not found")
+	ErrInvalidJob         = errors.New("invalid job")
+)
+
+// Job is a delayed or recurring send. A job either sends Text to the chat,
+// or calls the handler registered under the Handler name.
+type Job struct {
+	ID string
+	// ChatID is the chat the job is fired for.
+	ChatID int64
+	// UserID is the sender of the synthesized context, ChatID if zero.
+	UserID int64
+	// At is the time of the next run.
+	At time.Time
+
+	// Text is sent to the chat when Handler is empty.
+	Text string
+	// Handler is the name of a handler registered with Scheduler.Handle.
+	Handler string
+	// Data is an arbitrary payload for the handler.
+	Data string
+
+	// Cron makes the job recurring by the cron expression, see ParseCron.
+	Cron string
+	// Every makes the job recurring with the interval.
+	Every time.Duration
+}
+
+// Recurring reports whether the job is rescheduled after it runs.
+func (j Job) Recurring() bool {
+	return j.Cron != "" || j.Every > 0
+}
+
+// next returns the time of the run after now, or the zero time for one-off jobs.
+func (j Job) next(now time.Time) (time.Time, error) {
+	switch {
+	case j.Cron != "":
+		cron, err := ParseCron(j.Cron)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return cron.Next(now), nil
+	case j.Every > 0:
+		next := j.At
+		if next.IsZero() {
+			next = now
+		}
+		for !next.After(now) {
+			next = next.Add(j.Every)
+		}
+		return next, nil
+	default:
+		return time.Time{}, nil
+	}
+}
+
+// JobStore persists scheduled jobs, so they survive restarts.
+type JobStore interface {
+	// Save creates or replaces the job with the same ID.
+	Save(job Job) error
+	Delete(id string) error
+	// Due returns the jobs to run at now, ordered by time.
+	Due(now time.Time) ([]Job, error)
+}
+
+// MemoryJobStore is an in-memory JobStore.
+type MemoryJobStore struct {
+	lock sync.Mutex
+	jobs map[string]Job
+}
+
+func NewMemoryJobStore() *MemoryJobStore {
+	return &MemoryJobStore{jobs: map[string]Job{}}
+}
+
+func (s *MemoryJobStore) Save(job Job) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.jobs[job.ID] = job
+	return nil
+}
+
+func (s *MemoryJobStore) Delete(id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.jobs, id)
+	return nil
+}
+
+func (s *MemoryJobStore) Due(now time.Time) ([]Job, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var due []Job
+	for _, j := range s.jobs {
+		if !j.At.After(now) {
+			due = append(due, j)
+		}
+	}
+	sort.Slice(due, func(a, b int) bool {
+		return due[a].At.Before(due[b].At)
+	})
+	return due, nil
+}
+
+// JobHandler is called with a context synthesized for the chat of the job.
+type JobHandler func(ctx Context, job Job)
+
+// Scheduler fires delayed and recurring jobs of a Stage. Jobs are kept in
+// a JobStore, a scheduler started after a restart runs the jobs it missed
+// once and continues with their schedule.
+type Scheduler struct {
+	stage *Stage
+	store JobStore
+
+	// PollInterval is how often the store is checked for due jobs, a second by default.
+	PollInterval time.Duration
+	// OnError, if set, is called when a job fails or panics, and with a zero
+	// Job when the store fails to list due jobs. The scheduler keeps running.
+	OnError func(Job, error)
+
+	lock     sync.RWMutex
+	handlers map[string]JobHandler
+}
+
+// NewScheduler creates a scheduler for the stage. Messages are sent through the
+// client middleware of the stage.
+func NewScheduler(stage *Stage, store JobStore) *Scheduler {
+	return &Scheduler{
+		stage:        stage,
+		store:        store,
+		PollInterval: time.Second,
+		handlers:     map[string]JobHandler{},
+	}
+}
+
+// Handle registers the handler for jobs with the name.
+func (s *Scheduler) Handle(name string, h JobHandler) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.handlers[name] = h
+}
+
+// Schedule validates and saves the job. An ID is generated when empty, and
+// the first run of a recurring job is computed when At is zero.
+func (s *Scheduler) Schedule(job Job) (Job, error) {
+	if job.ChatID == 0 {
+		return job, fmt.Errorf("%w: chat id is required", ErrInvalidJob)
+	}
+	if job.Text == "" && job.Handler == "" {
+		return job, fmt.Errorf("%w: text or handler is required", ErrInvalidJob)
+	}
+	if job.ID == "" {
+		job.ID = newJobID()
+	}
+	if job.At.IsZero() {
+		if !job.Recurring() {
+			return job, fmt.Errorf("%w: time is required", ErrInvalidJob)
+		}
+		next, err := job.next(time.Now())
+		if err != nil {
+			return job, err
+		}
+		job.At = next
+	} else if job.Cron != "" {
+		if _, err := ParseCron(job.Cron); err != nil {
+			return job, err
+		}
+	}
+
+	return job, s.store.Save(job)
+}
+
+// Cancel removes the job.
+func (s *Scheduler) Cancel(id string) error {
+	return s.store.Delete(id)
+}
+
+// Run fires due jobs until the context is done.
+func (s *Scheduler) Run(ctx context.Context, bot *tgbotapi.BotAPI) error {
+	interval := s.PollInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.fire(bot, time.Now()); err != nil {
+			s.report(Job{}, err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// fire runs the jobs due at now and reschedules recurring ones.
+func (s *Scheduler) fire(bot *tgbotapi.BotAPI, now time.Time) error {
+	jobs, err := s.store.Due(now)
+	if err != nil {
+		return err
+	}
+
+	for _, job := range jobs {
+		if err := s.run(bot, job); err != nil {
+			s.report(job, err)
+		}
+
+		next, err := job.next(now)
+		if err != nil || next.IsZero() {
+			if err != nil {
+				s.report(job, err)
+			}
+			if err := s.store.Delete(job.ID); err != nil {
+				s.report(job, err)
+			}
+			continue
+		}
+
+		job.At = next
+		if err := s.store.Save(job); err != nil {
+			s.report(job, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *Scheduler) report(job Job, err error) {
+	if s.OnError != nil {
+		s.OnError(job, err)
+	}
+}
+
+func (s *Scheduler) run(bot *tgbotapi.BotAPI, job Job) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+
+	userID := job.UserID
+	if userID == 0 {
+		userID = job.ChatID
+	}
+	chatType := "private"
+	if job.ChatID < 0 {
+		chatType = "group"
+	}
+
+	ctx := s.stage.newContext(bot, &tgbotapi.Update{
+		Message: &tgbotapi.Message{
+			From: &tgbotapi.User{ID: userID},
+			Chat: &tgbotapi.Chat{ID: job.ChatID, Type: chatType},
+		},
+	})
+
+	if job.Handler == "" {
+		_, err := ctx.Reply(job.Text)
+		return err
+	}
+
+	s.lock.RLock()
+	h, ok := s.handlers[job.Handler]
+	s.lock.RUnlock()
+	if !ok {
+		return fmt.Errorf("%w with name %s", ErrJobHandlerNotFound, job.Handler)
+	}
+
+	h(ctx, job)
+	return nil
+}
+
+func newJobID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
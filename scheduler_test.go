@@ -0,0 +1,161 @@
+package telestage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScheduler_Schedule(t *testing.T) {
+	s := NewScheduler(NewStage(emptyStateGetter), NewMemoryJobStore())
+
+	_, err := s.Schedule(Job{Text: "hello", At: time.Now()})
+	assert.ErrorIs(t, err, ErrInvalidJob, "chat is required")
+
+	_, err = s.Schedule(Job{ChatID: 1, At: time.Now()})
+	assert.ErrorIs(t, err, ErrInvalidJob, "text or handler is required")
+
+	_, err = s.Schedule(Job{ChatID: 1, Text: "hello"})
+	assert.ErrorIs(t, err, ErrInvalidJob, "time is required for one-off jobs")
+
+	_, err = s.Schedule(Job{ChatID: 1, Text: "hello", Cron: "bad"})
+	assert.ErrorIs(t, err, ErrInvalidCron)
+
+	job, err := s.Schedule(Job{ChatID: 1, Text: "hello", Cron: "0 9 * * *"})
+	require.NoError(t, err)
+	assert.NotEmpty(t, job.ID)
+	assert.Equal(t, 9, job.At.Hour(), "first run of recurring job must be computed")
+}
+
+func TestScheduler_Fire(t *testing.T) {
+	srv, bot := newTestBot(t)
+	store := NewMemoryJobStore()
+	s := NewScheduler(NewStage(emptyStateGetter), store)
+
+	now := time.Now()
+	_, err := s.Schedule(Job{ID: "once", ChatID: 1, Text: "remember", At: now.Add(-time.Minute)})
+	require.NoError(t, err)
+	_, err = s.Schedule(Job{ID: "later", ChatID: 2, Text: "not yet", At: now.Add(time.Hour)})
+	require.NoError(t, err)
+	_, err = s.Schedule(Job{ID: "every", ChatID: 3, Text: "tick", At: now.Add(-90 * time.Minute), Every: time.Hour})
+	require.NoError(t, err)
+
+	require.NoError(t, s.fire(bot, now))
+
+	calls := srv.CallsTo("sendMessage")
+	require.Len(t, calls, 2)
+	assert.Equal(t, "tick", calls[0].Params.Get("text"), "jobs must run in time order")
+	assert.Equal(t, "remember", calls[1].Params.Get("text"))
+
+	due, _ := store.Due(now.Add(time.Hour))
+	require.Len(t, due, 2, "one-off job must be deleted")
+	assert.Equal(t, "every", due[0].ID)
+	assert.Equal(t, now.Add(30*time.Minute), due[0].At, "recurring job must keep its cadence")
+}
+
+func TestScheduler_Handler(t *testing.T) {
+	srv, bot := newTestBot(t)
+	s := NewScheduler(NewStage(emptyStateGetter), NewMemoryJobStore())
+
+	var errs []error
+	s.OnError = func(_ Job, err error) {
+		errs = append(errs, err)
+	}
+	s.Handle("digest", func(ctx Context, job Job) {
+		ctx.Reply("digest for " + job.Data)
+	})
+
+	_, err := s.Schedule(Job{ChatID: 5, Handler: "digest", Data: "today", At: time.Now()})
+	require.NoError(t, err)
+	_, err = s.Schedule(Job{ChatID: 5, Handler: "missing", At: time.Now()})
+	require.NoError(t, err)
+
+	require.NoError(t, s.fire(bot, time.Now()))
+
+	calls := srv.CallsTo("sendMessage")
+	require.Len(t, calls, 1)
+	assert.Equal(t, "5", calls[0].Params.Get("chat_id"))
+	assert.Equal(t, "digest for today", calls[0].Params.Get("text"))
+	require.Len(t, errs, 1)
+	assert.ErrorIs(t, errs[0], ErrJobHandlerNotFound)
+}
+
+func TestScheduler_Run(t *testing.T) {
+	srv, bot := newTestBot(t)
+	store := NewMemoryJobStore()
+
+	// a job saved before a restart
+	store.Save(Job{ID: "missed", ChatID: 1, Text: "missed", At: time.Now().Add(-time.Hour)})
+
+	s := NewScheduler(NewStage(emptyStateGetter), store)
+	s.PollInterval = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- s.Run(ctx, bot)
+	}()
+
+	_, err := s.Schedule(Job{ChatID: 1, Text: "soon", At: time.Now().Add(20 * time.Millisecond)})
+	require.NoError(t, err)
+
+	_, err = srv.WaitCalls(2, time.Second)
+	cancel()
+	assert.NoError(t, err)
+	assert.ErrorIs(t, <-done, context.Canceled)
+}
+
+type failingJobStore struct {
+	*MemoryJobStore
+	fail int
+}
+
+func (s *failingJobStore) Due(now time.Time) ([]Job, error) {
+	if s.fail > 0 {
+		s.fail--
+		return nil, errors.New("store is down")
+	}
+	return s.MemoryJobStore.Due(now)
+}
+
+func TestScheduler_RunErrors(t *testing.T) {
+	srv, bot := newTestBot(t)
+	store := &failingJobStore{MemoryJobStore: NewMemoryJobStore(), fail: 2}
+
+	errs := make(chan error, 10)
+	s := NewScheduler(NewStage(emptyStateGetter), store)
+	s.PollInterval = 5 * time.Millisecond
+	s.OnError = func(_ Job, err error) {
+		errs <- err
+	}
+	s.Handle("broken", func(Context, Job) {
+		panic("boom")
+	})
+
+	_, err := s.Schedule(Job{ChatID: 1, Handler: "broken", At: time.Now()})
+	require.NoError(t, err)
+	_, err = s.Schedule(Job{ChatID: 1, Text: "still running", At: time.Now()})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- s.Run(ctx, bot)
+	}()
+
+	_, err = srv.WaitCalls(1, time.Second)
+	cancel()
+	assert.NoError(t, err)
+	assert.ErrorIs(t, <-done, context.Canceled)
+
+	close(errs)
+	var got []string
+	for err := range errs {
+		got = append(got, err.Error())
+	}
+	assert.Equal(t, []string{"store is down", "store is down", "panic: boom"}, got)
+}
@@ -0,0 +1,139 @@
+package telestage
+
+import (
+	"fmt"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// SendOptions are the optional parameters of an outgoing message.
+// Parameters a method doesn't support are not sent with it.
+type SendOptions struct {
+	// ParseMode is tgbotapi.ModeHTML, tgbotapi.ModeMarkdownV2 or tgbotapi.ModeMarkdown.
+	ParseMode string
+	// ReplyMarkup is a keyboard, e.g. tgbotapi.InlineKeyboardMarkup.
+	ReplyMarkup      interface{}
+	ReplyToMessageID int
+	// MessageThreadID is the forum topic the message is sent to.
+	MessageThreadID       int
+	DisableNotification   bool
+	ProtectContent        bool
+	DisableWebPagePreview bool
+}
+
+// SendOption sets an optional parameter of an outgoing message.
+type SendOption func(*SendOptions)
+
+func WithParseMode(mode string) SendOption {
+	return func(o *SendOptions) {
+		o.ParseMode = mode
+	}
+}
+
+func WithMarkup(markup interface{}) SendOption {
+	return func(o *SendOptions) {
+		o.ReplyMarkup = markup
+	}
+}
+
+func WithReplyTo(messageID int) SendOption {
+	return func(o *SendOptions) {
+		o.ReplyToMessageID = messageID
+	}
+}
+
+func WithThreadID(threadID int) SendOption {
+	return func(o *SendOptions) {
+		o.MessageThreadID = threadID
+	}
+}
+
+// WithSilent sends the message without a notification sound.
+func WithSilent(silent bool) SendOption {
+	return func(o *SendOptions) {
+		o.DisableNotification = silent
+	}
+}
+
+// WithProtectContent protects the message from forwarding and saving.
+func WithProtectContent(protect bool) SendOption {
+	return func(o *SendOptions) {
+		o.ProtectContent = protect
+	}
+}
+
+// WithPreview enables or disables link previews of text messages.
+func WithPreview(enabled bool) SendOption {
+	return func(o *SendOptions) {
+		o.DisableWebPagePreview = !enabled
+	}
+}
+
+func newSendOptions(opts ...[]SendOption) SendOptions {
+	var o SendOptions
+	for _, list := range opts {
+		for _, opt := range list {
+			opt(&o)
+		}
+	}
+	return o
+}
+
+// addTo adds the parameters supported by every send method to params.
+// Link previews only apply to text, so they are added by the caller.
+func (o SendOptions) addTo(params tgbotapi.Params) error {
+	params.AddNonEmpty("parse_mode", o.ParseMode)
+	params.AddNonZero("reply_to_message_id", o.ReplyToMessageID)
+	params.AddNonZero("message_thread_id", o.MessageThreadID)
+	params.AddBool("disable_notification", o.DisableNotification)
+	params.AddBool("protect_content", o.ProtectContent)
+	return params.AddInterface("reply_markup", o.ReplyMarkup)
+}
+
+// prepareMediaGroup replaces the media to upload with attach:// references and
+// returns the files to upload along. Items without a parse mode get parseMode.
+func prepareMediaGroup(media []interface{}, parseMode string) ([]interface{}, []tgbotapi.RequestFile) {
+	var files []tgbotapi.RequestFile
+	attach := func(data tgbotapi.RequestFileData, name string) tgbotapi.RequestFileData {
+		if data == nil || !data.NeedsUpload() {
+			return data
+		}
+		files = append(files, tgbotapi.RequestFile{Name: name, Data: data})
+		return tgbotapi.FileID("attach://" + name)
+	}
+	base := func(m *tgbotapi.BaseInputMedia, i int) {
+		m.Media = attach(m.Media, fmt.Sprintf("file-%d", i))
+		if m.ParseMode == "" {
+			m.ParseMode = parseMode
+		}
+	}
+
+	prepared := make([]interface{}, len(media))
+	for i, item := range media {
+		thumb := fmt.Sprintf("file-%d-thumb", i)
+		switch m := item.(type) {
+		case tgbotapi.InputMediaPhoto:
+			base(&m.BaseInputMedia, i)
+			item = m
+		case tgbotapi.InputMediaVideo:
+			base(&m.BaseInputMedia, i)
+			m.Thumb = attach(m.Thumb, thumb)
+			item = m
+		case tgbotapi.InputMediaAnimation:
+			base(&m.BaseInputMedia, i)
+			m.Thumb = attach(m.Thumb, thumb)
+			item = m
+		case tgbotapi.InputMediaAudio:
+			base(&m.BaseInputMedia, i)
+			m.Thumb = attach(m.Thumb, thumb)
+			item = m
+		case tgbotapi.InputMediaDocument:
+			base(&m.BaseInputMedia, i)
+			m.Thumb = attach(m.Thumb, thumb)
+			item = m
+		}
+		prepared[i] = item
+	}
+
+	return prepared, files
+}
@@ -3,6 +3,8 @@ package telestage
 import (
 	"errors"
 	"fmt"
+	"sync"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
@@ -11,11 +13,47 @@ var (
 	ErrSceneNotFound = errors.New("scene not found")
 )
 
+const sceneKey = "telestage.scene"
+
 type StateGetter func(Context) string
 
+// UpdateInfo describes how the stage handled an update.
+type UpdateInfo struct {
+	Scene string
+	// Route is the name of the matched route, empty when no route matched.
+	Route    string
+	Duration time.Duration
+	// Err is the error returned by Stage.Run.
+	Err error
+	// Panic is the value the handler panicked with.
+	Panic interface{}
+	// Aborted is set when the route stopped handling with Abort.
+	Aborted bool
+}
+
+// Handled reports whether a route matched the update.
+func (i UpdateInfo) Handled() bool {
+	return i.Route != ""
+}
+
+// UpdateObserver is called after every update run by the stage, including
+// unhandled ones and those whose handler panicked.
+type UpdateObserver func(ctx Context, info UpdateInfo)
+
 type Stage struct {
-	scenes      map[string]*Scene
-	stateGetter StateGetter
+	scenes            map[string]*Scene
+	stateGetter       StateGetter
+	stateSetter       StateSetter
+	clientMiddlewares []ClientMiddleware
+	sendOptions       []SendOption
+	observers         []UpdateObserver
+	middlewares       []Middleware
+	tracer            Tracer
+
+	commandsLock         sync.Mutex
+	syncSceneCommands    bool
+	commandsErrorHandler func(Context, error)
+	commandScenes        map[commandsKey]string
 }
 
 func NewStage(stateGetter StateGetter) *Stage {
@@ -29,24 +67,118 @@ func (s *Stage) Add(state string, scene *Scene) {
 	s.scenes[state] = scene
 }
 
-func (s *Stage) Run(bot *tgbotapi.BotAPI, upd tgbotapi.Update) error {
-	ctx := &NativeContext{
-		bot: bot,
-		upd: &upd,
+// UseClient wraps outgoing Bot API requests made from handlers with middleware
+func (s *Stage) UseClient(mw ...ClientMiddleware) {
+	s.clientMiddlewares = append(s.clientMiddlewares, mw...)
+}
+
+// SetDefaultSendOptions sets the options of every message sent from handlers,
+// options passed to Context.Send and the other methods override them
+func (s *Stage) SetDefaultSendOptions(opts ...SendOption) {
+	s.sendOptions = opts
+}
+
+// Observe adds observers of the updates run by the stage, e.g. to collect metrics
+func (s *Stage) Observe(o ...UpdateObserver) {
+	s.observers = append(s.observers, o...)
+}
+
+func (s *Stage) Run(bot *tgbotapi.BotAPI, upd tgbotapi.Update) (err error) {
+	ctx := s.newContext(bot, &upd)
+	if len(s.observers) > 0 {
+		defer s.observe(ctx, time.Now(), &err)
+	}
+	if s.tracer != nil {
+		defer endUpdateSpan(ctx, s.startUpdateSpan(ctx), &err)
 	}
 
-	state := s.stateGetter(ctx)
+	if len(s.middlewares) == 0 {
+		return s.dispatch(ctx)
+	}
+	chainMiddleware(func(ctx Context) {
+		err = s.dispatch(ctx)
+	}, s.middlewares...)(ctx)
+	return err
+}
+
+// Use adds middleware running for every update before the scene is
+// resolved, e.g. to load the user or a session. It may stop handling the
+// update by not calling the next function, or choose the scene with SetScene.
+func (s *Stage) Use(mw ...Middleware) {
+	s.middlewares = append(s.middlewares, mw...)
+}
+
+// SetScene overrides the scene handling the update, so the StateGetter is
+// not called. It is meant for the middleware added with Stage.Use.
+func SetScene(ctx Context, state string) {
+	ctx.Set(sceneKey, state)
+}
+
+// dispatch runs the update through the routes of the scene
+func (s *Stage) dispatch(ctx Context) error {
+	state, ok := ctx.Get(sceneKey).(string)
+	if !ok {
+		state = s.stateGetter(ctx)
+	}
 	scene, ok := s.scenes[state]
 	if !ok {
 		return fmt.Errorf("%w with name %s", ErrSceneNotFound, state)
 	}
+	ctx.Set(sceneKey, state)
 
 	events := scene.GetEvents()
 	for _, e := range events {
 		if e(ctx) {
-			return nil
+			break
 		}
 	}
 
+	s.syncCommands(ctx)
 	return nil
 }
+
+// observe notifies the observers about the update, the panic of the handler is propagated
+func (s *Stage) observe(ctx Context, start time.Time, err *error) {
+	info := UpdateInfo{
+		Scene:    SceneName(ctx),
+		Route:    RouteName(ctx),
+		Duration: time.Since(start),
+		Err:      *err,
+		Panic:    recover(),
+		Aborted:  Aborted(ctx),
+	}
+	for _, o := range s.observers {
+		o(ctx, info)
+	}
+	if info.Panic != nil {
+		panic(info.Panic)
+	}
+}
+
+// newContext creates the context of the update, sending through the stage client middleware
+func (s *Stage) newContext(bot *tgbotapi.BotAPI, upd *tgbotapi.Update) *NativeContext {
+	ctx := &NativeContext{
+		upd:      upd,
+		defaults: s.sendOptions,
+	}
+
+	mw := s.clientMiddlewares
+	if upd.CallbackQuery != nil {
+		mw = append([]ClientMiddleware{trackAnswer(ctx)}, mw...)
+	}
+	if s.tracer != nil {
+		mw = append([]ClientMiddleware{traceClient(s.tracer, ctx)}, mw...)
+	}
+	if len(mw) > 0 {
+		bot = WrapBot(bot, mw...)
+	}
+	ctx.bot = bot
+
+	return ctx
+}
+
+// SceneName returns the state of the scene handling the update.
+func SceneName(ctx Context) string {
+	s, _ := ctx.Get(sceneKey).(string)
+	return s
+}
@@ -1,10 +1,14 @@
 package telestage
 
 import (
+	"context"
+	"net/http"
 	"testing"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type stateStorage struct {
@@ -94,3 +98,130 @@ func TestStage_NewStage(t *testing.T) {
 	}
 	assert.Equal(t, sg(ctx), stage.stateGetter(ctx), "new stage")
 }
+
+func TestStage_UseClient(t *testing.T) {
+	var methods []string
+	s := NewScene()
+	s.OnMessage(func(ctx Context) {
+		ctx.Reply("hello")
+	})
+	stage := NewStage(emptyStateGetter)
+	stage.Add("", s)
+	stage.UseClient(func(next tgbotapi.HTTPClient) tgbotapi.HTTPClient {
+		return ClientFunc(func(req *http.Request) (*http.Response, error) {
+			methods = append(methods, apiMethod(req))
+			return nil, context.Canceled
+		})
+	})
+
+	bot := &tgbotapi.BotAPI{}
+	bot.SetAPIEndpoint(tgbotapi.APIEndpoint)
+	stage.Run(bot, tgbotapi.Update{
+		Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 1}},
+	})
+
+	assert.Equal(t, []string{"sendMessage"}, methods)
+	assert.Nil(t, bot.Client, "original bot must not be modified")
+}
+
+func TestStage_SetDefaultSendOptions(t *testing.T) {
+	srv, bot := newTestBot(t)
+	s := NewScene()
+	s.OnMessage(func(ctx Context) {
+		ctx.ReplyHTML("hello", WithProtectContent(false))
+	})
+	stage := NewStage(emptyStateGetter)
+	stage.Add("", s)
+	stage.SetDefaultSendOptions(WithPreview(false), WithProtectContent(true))
+
+	require.NoError(t, stage.Run(bot, userMessage(1, 10, "hi")))
+
+	calls := srv.CallsTo("sendMessage")
+	require.Len(t, calls, 1)
+	assert.Equal(t, "true", calls[0].Params.Get("disable_web_page_preview"))
+	assert.Empty(t, calls[0].Params.Get("protect_content"))
+	assert.Equal(t, tgbotapi.ModeHTML, calls[0].Params.Get("parse_mode"))
+}
+
+func TestStage_Observe(t *testing.T) {
+	var infos []UpdateInfo
+	s := NewScene()
+	s.OnCommand("start", func(Context) {
+		time.Sleep(time.Millisecond)
+	})
+	stage := NewStage(func(ctx Context) string { return ctx.Text() })
+	stage.Add("/start", s)
+	stage.Observe(func(_ Context, info UpdateInfo) {
+		infos = append(infos, info)
+	})
+
+	upd := userMessage(1, 10, "/start")
+	upd.Message.Entities = []tgbotapi.MessageEntity{{Type: "bot_command", Length: 6}}
+	require.NoError(t, stage.Run(&tgbotapi.BotAPI{}, upd))
+	assert.Error(t, stage.Run(&tgbotapi.BotAPI{}, userMessage(1, 11, "other")))
+
+	require.Len(t, infos, 2)
+	assert.True(t, infos[0].Handled())
+	assert.Equal(t, "/start", infos[0].Scene)
+	assert.GreaterOrEqual(t, infos[0].Duration, time.Millisecond)
+	assert.False(t, infos[1].Handled())
+	assert.ErrorIs(t, infos[1].Err, ErrSceneNotFound)
+}
+
+func TestStage_Use(t *testing.T) {
+	var calls []string
+	main := NewScene()
+	main.OnMessage(func(ctx Context) {
+		calls = append(calls, "main "+ctx.Get("user").(string))
+	})
+	banned := NewScene()
+	banned.OnMessage(func(Context) { calls = append(calls, "banned") })
+
+	stage := NewStage(func(Context) string {
+		calls = append(calls, "state")
+		return "main"
+	})
+	stage.Add("main", main)
+	stage.Add("banned", banned)
+	stage.Use(func(next EventFn) EventFn {
+		return func(ctx Context) {
+			calls = append(calls, "first")
+			ctx.Set("user", "alice")
+			next(ctx)
+		}
+	}, func(next EventFn) EventFn {
+		return func(ctx Context) {
+			switch ctx.Chat().ID {
+			case 2:
+				SetScene(ctx, "banned")
+			case 3:
+				return
+			}
+			next(ctx)
+		}
+	})
+
+	require.NoError(t, stage.Run(&tgbotapi.BotAPI{}, userMessage(1, 1, "hi")))
+	assert.Equal(t, []string{"first", "state", "main alice"}, calls)
+
+	calls = nil
+	require.NoError(t, stage.Run(&tgbotapi.BotAPI{}, userMessage(2, 1, "hi")))
+	assert.Equal(t, []string{"first", "banned"}, calls)
+
+	calls = nil
+	require.NoError(t, stage.Run(&tgbotapi.BotAPI{}, userMessage(3, 1, "hi")))
+	assert.Equal(t, []string{"first"}, calls)
+}
+
+func TestStage_UseSceneNotFound(t *testing.T) {
+	stage := NewStage(emptyStateGetter)
+	stage.Use(func(next EventFn) EventFn {
+		return func(ctx Context) {
+			SetScene(ctx, "missing")
+			next(ctx)
+		}
+	})
+
+	err := stage.Run(&tgbotapi.BotAPI{}, userMessage(1, 1, "hi"))
+	assert.ErrorIs(t, err, ErrSceneNotFound)
+}
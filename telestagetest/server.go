@@ -0,0 +1,692 @@
+// Package telestagetest provides utilities for end-to-end testing of bots
+// built with telestage, without access to the real Telegram Bot API.
+package telestagetest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// DefaultToken is the bot token accepted by a Server created with NewServer.
+const DefaultToken = "123456:TEST"
+
+// Call is a single Bot API request received by the Server.
+type Call struct {
+	Method string     `json:"method"`
+	Params url.Values `json:"params,omitempty"`
+	// Files holds the names of uploaded multipart files by field name.
+	Files map[string]string `json:"files,omitempty"`
+}
+
+// Server is an in-process fake of the Telegram Bot API. It implements the
+// subset of methods used by tgbotapi.BotAPI for polling and replying:
+// getMe, getUpdates, sendMessage, editMessageText, editMessageReplyMarkup,
+// deleteMessage, answerCallbackQuery, sendPhoto, sendDocument,
+// sendMediaGroup, forwardMessage, copyMessage, sendChatAction, getFile,
+// getChatMember, getChatAdministrators, setMyCommands and deleteMyCommands.
+type Server struct {
+	// URL is the base URL of the server, e.g. http://127.0.0.1:1234
+	URL   string
+	Token string
+	Self  tgbotapi.User
+
+	srv  *httptest.Server
+	done chan struct{}
+
+	lock          sync.Mutex
+	updates       []tgbotapi.Update
+	updatesSignal chan struct{}
+	nextUpdateID  int
+	nextMessageID int
+	nextFileID    int
+	messages      map[int64]map[int]*tgbotapi.Message
+	files         map[string]tgbotapi.File
+	calls         []Call
+	failures      map[string][]apiResponse
+	members       map[int64]map[int64]tgbotapi.ChatMember
+}
+
+// NewServer starts a fake Bot API server. It must be closed with Close.
+func NewServer() *Server {
+	s := &Server{
+		Token: DefaultToken,
+		Self: tgbotapi.User{
+			ID:        123456,
+			IsBot:     true,
+			FirstName: "Test",
+			UserName:  "test_bot",
+		},
+		done:          make(chan struct{}),
+		updatesSignal: make(chan struct{}),
+		nextUpdateID:  1,
+		nextMessageID: 1,
+		messages:      map[int64]map[int]*tgbotapi.Message{},
+		files:         map[string]tgbotapi.File{},
+		failures:      map[string][]apiResponse{},
+		members:       map[int64]map[int64]tgbotapi.ChatMember{},
+	}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.srv.URL
+
+	return s
+}
+
+// Close shuts the server down and releases pending getUpdates requests.
+func (s *Server) Close() {
+	close(s.done)
+	s.srv.Close()
+}
+
+// Endpoint returns the API endpoint template for tgbotapi.NewBotAPIWithAPIEndpoint.
+func (s *Server) Endpoint() string {
+	return s.URL + "/bot%s/%s"
+}
+
+// Bot returns a real tgbotapi.BotAPI pointed at the server.
+func (s *Server) Bot() (*tgbotapi.BotAPI, error) {
+	return tgbotapi.NewBotAPIWithAPIEndpoint(s.Token, s.Endpoint())
+}
+
+// PushUpdate enqueues an update for getUpdates. The update ID is assigned
+// by the server and the resulting update is returned.
+func (s *Server) PushUpdate(upd tgbotapi.Update) tgbotapi.Update {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	upd.UpdateID = s.nextUpdateID
+	s.nextUpdateID++
+	s.updates = append(s.updates, upd)
+	s.remember(upd)
+
+	close(s.updatesSignal)
+	s.updatesSignal = make(chan struct{})
+
+	return upd
+}
+
+// remember stores the message of the update, so the bot can reply to, forward or delete it.
+func (s *Server) remember(upd tgbotapi.Update) {
+	m := upd.Message
+	if m == nil || m.Chat == nil {
+		return
+	}
+	if s.messages[m.Chat.ID] == nil {
+		s.messages[m.Chat.ID] = map[int]*tgbotapi.Message{}
+	}
+	if _, exists := s.messages[m.Chat.ID][m.MessageID]; !exists {
+		s.messages[m.Chat.ID][m.MessageID] = m
+	}
+	// like in Telegram, messages of the bot and users share the sequence of IDs
+	if m.MessageID >= s.nextMessageID {
+		s.nextMessageID = m.MessageID + 1
+	}
+}
+
+// Calls returns every request received so far, except getMe and getUpdates.
+func (s *Server) Calls() []Call {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	calls := make([]Call, len(s.calls))
+	copy(calls, s.calls)
+	return calls
+}
+
+// CallsTo returns the received requests of the given method.
+func (s *Server) CallsTo(method string) []Call {
+	var calls []Call
+	for _, c := range s.Calls() {
+		if c.Method == method {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+// WaitCalls blocks until at least n calls were received or the timeout expires.
+func (s *Server) WaitCalls(n int, timeout time.Duration) ([]Call, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		calls := s.Calls()
+		if len(calls) >= n {
+			return calls, nil
+		}
+		if time.Now().After(deadline) {
+			return calls, fmt.Errorf("got %d calls, want %d", len(calls), n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// Message returns a message previously sent by the bot.
+func (s *Server) Message(chatID int64, messageID int) (tgbotapi.Message, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	m, ok := s.messages[chatID][messageID]
+	if !ok {
+		return tgbotapi.Message{}, false
+	}
+	return *m, true
+}
+
+// FailNext makes the next call of the method fail with the error code and
+// description. A positive retryAfter is returned in the response parameters,
+// as Telegram does for "Too Many Requests" errors. Failures are queued, so
+// calling FailNext several times fails several calls in a row.
+func (s *Server) FailNext(method string, code int, description string, retryAfter int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	resp := apiResponse{ErrorCode: code, Description: description}
+	if retryAfter > 0 {
+		resp.Parameters = &tgbotapi.ResponseParameters{RetryAfter: retryAfter}
+	}
+	s.failures[method] = append(s.failures[method], resp)
+}
+
+// SetChatMember sets the member of the chat returned by getChatMember and,
+// for creators and administrators, by getChatAdministrators. Users without
+// a member set are plain members of every chat.
+func (s *Server) SetChatMember(chatID int64, member tgbotapi.ChatMember) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.members[chatID] == nil {
+		s.members[chatID] = map[int64]tgbotapi.ChatMember{}
+	}
+	s.members[chatID][member.User.ID] = member
+}
+
+// WebhookRequest builds the request Telegram would send to a webhook, to be
+// passed to tgbotapi.BotAPI.HandleUpdate or an http.Handler.
+func WebhookRequest(target string, upd tgbotapi.Update) (*http.Request, error) {
+	body, err := json.Marshal(upd)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+type apiResponse struct {
+	Ok          bool                         `json:"ok"`
+	Result      interface{}                  `json:"result,omitempty"`
+	ErrorCode   int                          `json:"error_code,omitempty"`
+	Description string                       `json:"description,omitempty"`
+	Parameters  *tgbotapi.ResponseParameters `json:"parameters,omitempty"`
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if len(parts) != 2 || !strings.HasPrefix(parts[0], "bot") {
+		writeResponse(w, http.StatusNotFound, apiResponse{ErrorCode: 404, Description: "Not Found"})
+		return
+	}
+	if strings.TrimPrefix(parts[0], "bot") != s.Token {
+		writeResponse(w, http.StatusUnauthorized, apiResponse{ErrorCode: 401, Description: "Unauthorized"})
+		return
+	}
+
+	call, err := parseCall(parts[1], r)
+	if err != nil {
+		writeResponse(w, http.StatusBadRequest, apiResponse{ErrorCode: 400, Description: "Bad Request: " + err.Error()})
+		return
+	}
+
+	resp := s.handle(call)
+	status := http.StatusOK
+	if !resp.Ok {
+		status = resp.ErrorCode
+	}
+	writeResponse(w, status, resp)
+}
+
+func parseCall(method string, r *http.Request) (Call, error) {
+	call := Call{Method: method, Params: url.Values{}}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := r.ParseMultipartForm(32 << 20); err != nil {
+			return call, err
+		}
+		for k, v := range r.MultipartForm.Value {
+			call.Params[k] = v
+		}
+		for field, headers := range r.MultipartForm.File {
+			if call.Files == nil {
+				call.Files = map[string]string{}
+			}
+			call.Files[field] = headers[0].Filename
+		}
+		return call, nil
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return call, err
+	}
+	call.Params = r.Form
+	return call, nil
+}
+
+func writeResponse(w http.ResponseWriter, status int, resp apiResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func ok(result interface{}) apiResponse {
+	return apiResponse{Ok: true, Result: result}
+}
+
+func badRequest(description string) apiResponse {
+	return apiResponse{ErrorCode: 400, Description: "Bad Request: " + description}
+}
+
+func (s *Server) handle(call Call) apiResponse {
+	switch call.Method {
+	case "getMe":
+		return ok(s.Self)
+	case "getUpdates":
+		return s.getUpdates(call.Params)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.calls = append(s.calls, call)
+
+	if failures := s.failures[call.Method]; len(failures) > 0 {
+		s.failures[call.Method] = failures[1:]
+		return failures[0]
+	}
+
+	switch call.Method {
+	case "sendMessage":
+		return s.sendMessage(call.Params)
+	case "editMessageText":
+		return s.editMessageText(call.Params)
+	case "answerCallbackQuery":
+		if call.Params.Get("callback_query_id") == "" {
+			return badRequest("query id is empty")
+		}
+		return ok(true)
+	case "editMessageReplyMarkup":
+		return s.editMessageReplyMarkup(call.Params)
+	case "deleteMessage":
+		return s.deleteMessage(call.Params)
+	case "sendPhoto":
+		return s.sendPhoto(call)
+	case "sendDocument":
+		return s.sendDocument(call)
+	case "sendMediaGroup":
+		return s.sendMediaGroup(call)
+	case "forwardMessage", "copyMessage":
+		return s.forwardMessage(call.Method, call.Params)
+	case "sendChatAction":
+		if _, err := s.chat(call.Params); err != nil {
+			return badRequest(err.Error())
+		}
+		return ok(true)
+	case "getFile":
+		return s.getFile(call.Params)
+	case "getChatMember":
+		return s.getChatMember(call.Params)
+	case "getChatAdministrators":
+		return s.getChatAdministrators(call.Params)
+	case "setMyCommands", "deleteMyCommands":
+		return ok(true)
+	default:
+		return apiResponse{ErrorCode: 404, Description: "Not Found: method not found"}
+	}
+}
+
+func (s *Server) getUpdates(p url.Values) apiResponse {
+	offset, _ := strconv.Atoi(p.Get("offset"))
+	limit, _ := strconv.Atoi(p.Get("limit"))
+	timeout, _ := strconv.Atoi(p.Get("timeout"))
+	if limit <= 0 || limit > 100 {
+		limit = 100
+	}
+
+	deadline := time.NewTimer(time.Duration(timeout) * time.Second)
+	defer deadline.Stop()
+
+	for {
+		s.lock.Lock()
+		if offset > 0 {
+			// like Telegram, updates below the offset are confirmed and forgotten
+			i := 0
+			for i < len(s.updates) && s.updates[i].UpdateID < offset {
+				i++
+			}
+			s.updates = s.updates[i:]
+		}
+		n := len(s.updates)
+		if n > limit {
+			n = limit
+		}
+		updates := make([]tgbotapi.Update, n)
+		copy(updates, s.updates[:n])
+		signal := s.updatesSignal
+		s.lock.Unlock()
+
+		if len(updates) > 0 || timeout <= 0 {
+			return ok(updates)
+		}
+
+		select {
+		case <-signal:
+		case <-deadline.C:
+			return ok(updates)
+		case <-s.done:
+			return ok(updates)
+		}
+	}
+}
+
+func (s *Server) chat(p url.Values) (*tgbotapi.Chat, error) {
+	id, err := strconv.ParseInt(p.Get("chat_id"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("chat not found")
+	}
+
+	chatType := "private"
+	if id < 0 {
+		chatType = "group"
+	}
+	return &tgbotapi.Chat{ID: id, Type: chatType}, nil
+}
+
+func (s *Server) newMessage(chat *tgbotapi.Chat, p url.Values) *tgbotapi.Message {
+	m := &tgbotapi.Message{
+		MessageID: s.nextMessageID,
+		From:      &s.Self,
+		Chat:      chat,
+		Date:      int(time.Now().Unix()),
+	}
+	s.nextMessageID++
+
+	if markup := p.Get("reply_markup"); markup != "" {
+		var kb tgbotapi.InlineKeyboardMarkup
+		if err := json.Unmarshal([]byte(markup), &kb); err == nil && kb.InlineKeyboard != nil {
+			m.ReplyMarkup = &kb
+		}
+	}
+	if replyTo, err := strconv.Atoi(p.Get("reply_to_message_id")); err == nil {
+		if original, ok := s.messages[chat.ID][replyTo]; ok {
+			m.ReplyToMessage = original
+		}
+	}
+
+	if s.messages[chat.ID] == nil {
+		s.messages[chat.ID] = map[int]*tgbotapi.Message{}
+	}
+	s.messages[chat.ID][m.MessageID] = m
+
+	return m
+}
+
+func (s *Server) sendMessage(p url.Values) apiResponse {
+	chat, err := s.chat(p)
+	if err != nil {
+		return badRequest(err.Error())
+	}
+	if p.Get("text") == "" {
+		return badRequest("message text is empty")
+	}
+
+	m := s.newMessage(chat, p)
+	m.Text = p.Get("text")
+
+	return ok(m)
+}
+
+func (s *Server) editMessageText(p url.Values) apiResponse {
+	if p.Get("inline_message_id") != "" {
+		return ok(true)
+	}
+
+	chat, err := s.chat(p)
+	if err != nil {
+		return badRequest(err.Error())
+	}
+	id, _ := strconv.Atoi(p.Get("message_id"))
+	m, found := s.messages[chat.ID][id]
+	if !found {
+		return badRequest("message to edit not found")
+	}
+	if m.Text == p.Get("text") && p.Get("reply_markup") == "" {
+		return badRequest("message is not modified")
+	}
+
+	m.Text = p.Get("text")
+	m.EditDate = int(time.Now().Unix())
+	m.ReplyMarkup = nil
+	if markup := p.Get("reply_markup"); markup != "" {
+		var kb tgbotapi.InlineKeyboardMarkup
+		if err := json.Unmarshal([]byte(markup), &kb); err == nil {
+			m.ReplyMarkup = &kb
+		}
+	}
+
+	return ok(m)
+}
+
+func (s *Server) editMessageReplyMarkup(p url.Values) apiResponse {
+	if p.Get("inline_message_id") != "" {
+		return ok(true)
+	}
+
+	m, resp := s.findMessage(p, "message to edit not found")
+	if m == nil {
+		return resp
+	}
+
+	m.ReplyMarkup = nil
+	if markup := p.Get("reply_markup"); markup != "" {
+		var kb tgbotapi.InlineKeyboardMarkup
+		if err := json.Unmarshal([]byte(markup), &kb); err == nil {
+			m.ReplyMarkup = &kb
+		}
+	}
+
+	return ok(m)
+}
+
+func (s *Server) deleteMessage(p url.Values) apiResponse {
+	m, resp := s.findMessage(p, "message to delete not found")
+	if m == nil {
+		return resp
+	}
+
+	delete(s.messages[m.Chat.ID], m.MessageID)
+	return ok(true)
+}
+
+// findMessage returns the message identified by chat_id and message_id, or the error response.
+func (s *Server) findMessage(p url.Values, notFound string) (*tgbotapi.Message, apiResponse) {
+	chat, err := s.chat(p)
+	if err != nil {
+		return nil, badRequest(err.Error())
+	}
+	id, _ := strconv.Atoi(p.Get("message_id"))
+	m, found := s.messages[chat.ID][id]
+	if !found {
+		return nil, badRequest(notFound)
+	}
+	return m, apiResponse{}
+}
+
+// file registers the file sent in the field: uploaded or referenced by file ID.
+func (s *Server) file(call Call, field, kind string) string {
+	fileID := call.Params.Get(field)
+	if _, uploaded := call.Files[field]; uploaded || fileID == "" {
+		fileID = fmt.Sprintf("%s-%d", kind, s.nextFileID)
+		s.nextFileID++
+	}
+	s.registerFile(fileID, kind)
+	return fileID
+}
+
+func (s *Server) registerFile(fileID, kind string) {
+	if _, known := s.files[fileID]; !known {
+		s.files[fileID] = tgbotapi.File{
+			FileID:       fileID,
+			FileUniqueID: "u" + fileID,
+			FilePath:     kind + "s/" + fileID,
+		}
+	}
+}
+
+func (s *Server) sendPhoto(call Call) apiResponse {
+	chat, err := s.chat(call.Params)
+	if err != nil {
+		return badRequest(err.Error())
+	}
+
+	fileID := s.file(call, "photo", "photo")
+
+	m := s.newMessage(chat, call.Params)
+	m.Caption = call.Params.Get("caption")
+	m.Photo = []tgbotapi.PhotoSize{{FileID: fileID, FileUniqueID: "u" + fileID}}
+
+	return ok(m)
+}
+
+func (s *Server) sendDocument(call Call) apiResponse {
+	chat, err := s.chat(call.Params)
+	if err != nil {
+		return badRequest(err.Error())
+	}
+
+	fileID := s.file(call, "document", "document")
+
+	m := s.newMessage(chat, call.Params)
+	m.Caption = call.Params.Get("caption")
+	m.Document = &tgbotapi.Document{FileID: fileID, FileUniqueID: "u" + fileID, FileName: call.Files["document"]}
+
+	return ok(m)
+}
+
+func (s *Server) sendMediaGroup(call Call) apiResponse {
+	chat, err := s.chat(call.Params)
+	if err != nil {
+		return badRequest(err.Error())
+	}
+
+	var media []struct {
+		Type    string `json:"type"`
+		Media   string `json:"media"`
+		Caption string `json:"caption"`
+	}
+	if err := json.Unmarshal([]byte(call.Params.Get("media")), &media); err != nil || len(media) < 2 || len(media) > 10 {
+		return badRequest("wrong number of media specified")
+	}
+
+	groupID := strconv.Itoa(s.nextMessageID)
+	messages := make([]*tgbotapi.Message, 0, len(media))
+	for _, item := range media {
+		fileID := item.Media
+		if field := strings.TrimPrefix(item.Media, "attach://"); field != item.Media {
+			fileID = s.file(call, field, item.Type)
+		} else {
+			s.registerFile(fileID, item.Type)
+		}
+
+		m := s.newMessage(chat, call.Params)
+		m.MediaGroupID = groupID
+		m.Caption = item.Caption
+		switch item.Type {
+		case "photo":
+			m.Photo = []tgbotapi.PhotoSize{{FileID: fileID, FileUniqueID: "u" + fileID}}
+		default:
+			m.Document = &tgbotapi.Document{FileID: fileID, FileUniqueID: "u" + fileID}
+		}
+		messages = append(messages, m)
+	}
+
+	return ok(messages)
+}
+
+func (s *Server) forwardMessage(method string, p url.Values) apiResponse {
+	chat, err := s.chat(p)
+	if err != nil {
+		return badRequest(err.Error())
+	}
+
+	fromChat, err := strconv.ParseInt(p.Get("from_chat_id"), 10, 64)
+	if err != nil {
+		return badRequest("chat not found")
+	}
+	messageID, _ := strconv.Atoi(p.Get("message_id"))
+
+	m := s.newMessage(chat, p)
+	// messages of users are unknown to the server, only the content of bot messages is copied
+	if original, found := s.messages[fromChat][messageID]; found {
+		m.Text = original.Text
+		m.Caption = original.Caption
+		m.Photo = original.Photo
+		m.Document = original.Document
+	}
+
+	if method == "copyMessage" {
+		return ok(tgbotapi.MessageID{MessageID: m.MessageID})
+	}
+	m.ForwardFromChat = &tgbotapi.Chat{ID: fromChat}
+	m.ForwardFromMessageID = messageID
+	return ok(m)
+}
+
+func (s *Server) getFile(p url.Values) apiResponse {
+	f, found := s.files[p.Get("file_id")]
+	if !found {
+		return badRequest("invalid file_id")
+	}
+	return ok(f)
+}
+
+func (s *Server) getChatMember(p url.Values) apiResponse {
+	chat, err := s.chat(p)
+	if err != nil {
+		return badRequest(err.Error())
+	}
+	userID, err := strconv.ParseInt(p.Get("user_id"), 10, 64)
+	if err != nil {
+		return badRequest("user not found")
+	}
+
+	if m, found := s.members[chat.ID][userID]; found {
+		return ok(m)
+	}
+	return ok(tgbotapi.ChatMember{User: &tgbotapi.User{ID: userID}, Status: "member"})
+}
+
+func (s *Server) getChatAdministrators(p url.Values) apiResponse {
+	chat, err := s.chat(p)
+	if err != nil {
+		return badRequest(err.Error())
+	}
+
+	admins := []tgbotapi.ChatMember{}
+	for _, m := range s.members[chat.ID] {
+		if m.IsCreator() || m.IsAdministrator() {
+			admins = append(admins, m)
+		}
+	}
+	sort.Slice(admins, func(i, j int) bool { return admins[i].User.ID < admins[j].User.ID })
+	return ok(admins)
+}
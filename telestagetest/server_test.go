@@ -0,0 +1,210 @@
+package telestagetest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/askoldex/telestage"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func textUpdate(chatID int64, text string) tgbotapi.Update {
+	m := &tgbotapi.Message{
+		MessageID: 1,
+		From:      &tgbotapi.User{ID: chatID},
+		Chat:      &tgbotapi.Chat{ID: chatID, Type: "private"},
+		Text:      text,
+	}
+	if len(text) > 0 && text[0] == '/' {
+		m.Entities = []tgbotapi.MessageEntity{{Type: "bot_command", Length: len(text)}}
+	}
+	return tgbotapi.Update{Message: m}
+}
+
+func TestServer_Bot(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	bot, err := srv.Bot()
+	require.NoError(t, err)
+	assert.Equal(t, srv.Self.UserName, bot.Self.UserName, "bot must be initialized with getMe")
+}
+
+func TestServer_Unauthorized(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	_, err := tgbotapi.NewBotAPIWithAPIEndpoint("wrong", srv.Endpoint())
+	assert.Error(t, err, "wrong token must be rejected")
+}
+
+func TestServer_Polling(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	bot, err := srv.Bot()
+	require.NoError(t, err)
+
+	stg := telestage.NewStage(func(_ telestage.Context) string { return "" })
+	scene := telestage.NewScene()
+	scene.OnStart(func(ctx telestage.Context) {
+		ctx.Reply("hello")
+	})
+	stg.Add("", scene)
+
+	srv.PushUpdate(textUpdate(42, "/start"))
+
+	u := tgbotapi.NewUpdate(0)
+	u.Timeout = 1
+	upds := bot.GetUpdatesChan(u)
+	defer bot.StopReceivingUpdates()
+
+	select {
+	case upd := <-upds:
+		require.NoError(t, stg.Run(bot, upd))
+	case <-time.After(3 * time.Second):
+		t.Fatal("update was not received")
+	}
+
+	calls := srv.CallsTo("sendMessage")
+	require.Len(t, calls, 1)
+	assert.Equal(t, "42", calls[0].Params.Get("chat_id"))
+	assert.Equal(t, "hello", calls[0].Params.Get("text"))
+}
+
+func TestServer_Webhook(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	bot, err := srv.Bot()
+	require.NoError(t, err)
+
+	stg := telestage.NewStage(func(_ telestage.Context) string { return "" })
+	scene := telestage.NewScene()
+	scene.OnMessage(func(ctx telestage.Context) {
+		ctx.Reply("echo: " + ctx.Text())
+	})
+	stg.Add("", scene)
+
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upd, err := bot.HandleUpdate(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		stg.Run(bot, *upd)
+	}))
+	defer hook.Close()
+
+	req, err := WebhookRequest(hook.URL, textUpdate(7, "ping"))
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	calls := srv.CallsTo("sendMessage")
+	require.Len(t, calls, 1)
+	assert.Equal(t, "echo: ping", calls[0].Params.Get("text"))
+}
+
+func TestServer_EditMessageText(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	bot, err := srv.Bot()
+	require.NoError(t, err)
+
+	m, err := bot.Send(tgbotapi.NewMessage(1, "before"))
+	require.NoError(t, err)
+
+	_, err = bot.Send(tgbotapi.NewEditMessageText(1, m.MessageID, "after"))
+	require.NoError(t, err)
+
+	edited, ok := srv.Message(1, m.MessageID)
+	require.True(t, ok)
+	assert.Equal(t, "after", edited.Text)
+
+	_, err = bot.Send(tgbotapi.NewEditMessageText(1, 100, "missing"))
+	assert.Error(t, err, "editing unknown message must fail")
+}
+
+func TestServer_AnswerCallbackQuery(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	bot, err := srv.Bot()
+	require.NoError(t, err)
+
+	_, err = bot.Request(tgbotapi.NewCallback("query", "done"))
+	require.NoError(t, err)
+	assert.Len(t, srv.CallsTo("answerCallbackQuery"), 1)
+}
+
+func TestServer_SendPhotoAndGetFile(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	bot, err := srv.Bot()
+	require.NoError(t, err)
+
+	m, err := bot.Send(tgbotapi.NewPhoto(1, tgbotapi.FileBytes{Name: "cat.jpg", Bytes: []byte("jpeg")}))
+	require.NoError(t, err)
+	require.Len(t, m.Photo, 1)
+
+	calls := srv.CallsTo("sendPhoto")
+	require.Len(t, calls, 1)
+	assert.Equal(t, "cat.jpg", calls[0].Files["photo"])
+
+	f, err := bot.GetFile(tgbotapi.FileConfig{FileID: m.Photo[0].FileID})
+	require.NoError(t, err)
+	assert.Equal(t, m.Photo[0].FileID, f.FileID)
+}
+
+func TestServer_FailNext(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	bot, err := srv.Bot()
+	require.NoError(t, err)
+
+	srv.FailNext("sendMessage", 429, "Too Many Requests: retry after 5", 5)
+
+	_, err = bot.Send(tgbotapi.NewMessage(1, "first"))
+	var apiErr *tgbotapi.Error
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, 429, apiErr.Code)
+	assert.Equal(t, 5, apiErr.RetryAfter)
+
+	_, err = bot.Send(tgbotapi.NewMessage(1, "second"))
+	assert.NoError(t, err, "only the next call must fail")
+	assert.Len(t, srv.CallsTo("sendMessage"), 2)
+}
+
+func TestServer_ChatMembers(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	bot, err := srv.Bot()
+	require.NoError(t, err)
+
+	srv.SetChatMember(-1, tgbotapi.ChatMember{User: &tgbotapi.User{ID: 2}, Status: "administrator", CanDeleteMessages: true})
+	srv.SetChatMember(-1, tgbotapi.ChatMember{User: &tgbotapi.User{ID: 3}, Status: "kicked"})
+
+	m, err := bot.GetChatMember(tgbotapi.GetChatMemberConfig{ChatConfigWithUser: tgbotapi.ChatConfigWithUser{ChatID: -1, UserID: 2}})
+	require.NoError(t, err)
+	assert.True(t, m.IsAdministrator())
+	assert.True(t, m.CanDeleteMessages)
+
+	m, err = bot.GetChatMember(tgbotapi.GetChatMemberConfig{ChatConfigWithUser: tgbotapi.ChatConfigWithUser{ChatID: -1, UserID: 4}})
+	require.NoError(t, err)
+	assert.Equal(t, "member", m.Status)
+
+	admins, err := bot.GetChatAdministrators(tgbotapi.ChatAdministratorsConfig{ChatConfig: tgbotapi.ChatConfig{ChatID: -1}})
+	require.NoError(t, err)
+	require.Len(t, admins, 1)
+	assert.Equal(t, int64(2), admins[0].User.ID)
+}
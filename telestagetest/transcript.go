@@ -0,0 +1,332 @@
+package telestagetest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// UpdateGoldenEnv is the environment variable which makes AssertGolden
+// rewrite golden files instead of comparing against them.
+const UpdateGoldenEnv = "TELESTAGE_UPDATE_GOLDEN"
+
+// Handler processes a single update, e.g. (*telestage.Stage).Run.
+type Handler func(*tgbotapi.BotAPI, tgbotapi.Update) error
+
+// Entry is a single line of a transcript: an incoming update, an outgoing
+// Bot API call or a handler error.
+type Entry struct {
+	Update *tgbotapi.Update `json:"update,omitempty"`
+	Call   *Call            `json:"call,omitempty"`
+	Error  string           `json:"error,omitempty"`
+}
+
+// String renders the entry in the transcript text format.
+func (e Entry) String() string {
+	switch {
+	case e.Update != nil:
+		return "<- " + formatUpdate(*e.Update)
+	case e.Call != nil:
+		return "-> " + formatCall(*e.Call)
+	default:
+		return "!! " + e.Error
+	}
+}
+
+// Recorder drives a handler with updates against a fake Server and records
+// the conversation as a transcript.
+type Recorder struct {
+	tb      testing.TB
+	srv     *Server
+	bot     *tgbotapi.BotAPI
+	handler Handler
+	entries []Entry
+}
+
+// NewRecorder starts a Server for the handler. The server is closed when the test ends.
+func NewRecorder(tb testing.TB, handler Handler) *Recorder {
+	tb.Helper()
+
+	srv := NewServer()
+	tb.Cleanup(srv.Close)
+
+	bot, err := srv.Bot()
+	if err != nil {
+		tb.Fatalf("telestagetest: create bot: %v", err)
+	}
+
+	return &Recorder{
+		tb:      tb,
+		srv:     srv,
+		bot:     bot,
+		handler: handler,
+	}
+}
+
+// Server returns the fake server the recorder talks to.
+func (r *Recorder) Server() *Server {
+	return r.srv
+}
+
+// Bot returns the bot passed to the handler.
+func (r *Recorder) Bot() *tgbotapi.BotAPI {
+	return r.bot
+}
+
+// Send passes the update to the handler and records it together with all
+// Bot API calls made while handling it.
+func (r *Recorder) Send(upd tgbotapi.Update) {
+	r.tb.Helper()
+
+	before := len(r.srv.Calls())
+	r.entries = append(r.entries, Entry{Update: &upd})
+
+	r.srv.lock.Lock()
+	r.srv.remember(upd)
+	r.srv.lock.Unlock()
+
+	err := r.handler(r.bot, upd)
+
+	calls := r.srv.Calls()[before:]
+	for i := range calls {
+		r.entries = append(r.entries, Entry{Call: &calls[i]})
+	}
+	if err != nil {
+		r.entries = append(r.entries, Entry{Error: err.Error()})
+	}
+}
+
+// Message sends a text message from the user in a private chat.
+func (r *Recorder) Message(userID int64, text string) {
+	r.tb.Helper()
+
+	// the message takes the next ID of the server, shared with the messages of the bot
+	r.srv.lock.Lock()
+	id := r.srv.nextMessageID
+	r.srv.nextMessageID++
+	r.srv.lock.Unlock()
+
+	m := &tgbotapi.Message{
+		MessageID: id,
+		From:      &tgbotapi.User{ID: userID},
+		Chat:      &tgbotapi.Chat{ID: userID, Type: "private"},
+		Text:      text,
+	}
+	if strings.HasPrefix(text, "/") {
+		length := len(text)
+		if i := strings.IndexByte(text, ' '); i > 0 {
+			length = i
+		}
+		m.Entities = []tgbotapi.MessageEntity{{Type: "bot_command", Length: length}}
+	}
+	r.Send(tgbotapi.Update{Message: m})
+}
+
+// Callback sends a callback query from the user pressing a button with data
+// on the message.
+func (r *Recorder) Callback(userID int64, messageID int, data string) {
+	r.tb.Helper()
+
+	m, ok := r.srv.Message(userID, messageID)
+	if !ok {
+		m = tgbotapi.Message{MessageID: messageID, Chat: &tgbotapi.Chat{ID: userID, Type: "private"}}
+	}
+	r.Send(tgbotapi.Update{
+		CallbackQuery: &tgbotapi.CallbackQuery{
+			ID:      strconv.Itoa(len(r.entries) + 1),
+			From:    &tgbotapi.User{ID: userID},
+			Message: &m,
+			Data:    data,
+		},
+	})
+}
+
+// Entries returns the recorded transcript.
+func (r *Recorder) Entries() []Entry {
+	return r.entries
+}
+
+// String renders the transcript, one entry per line.
+func (r *Recorder) String() string {
+	var b strings.Builder
+	for _, e := range r.entries {
+		b.WriteString(e.String())
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// JSON renders the transcript as an indented JSON array of entries.
+func (r *Recorder) JSON() ([]byte, error) {
+	entries := r.entries
+	if entries == nil {
+		entries = []Entry{}
+	}
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(entries); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// AssertGolden compares the transcript with the golden file and fails the
+// test with a diff on mismatch. When UpdateGoldenEnv is set the golden file
+// is written instead.
+func (r *Recorder) AssertGolden(path string) {
+	r.tb.Helper()
+	r.assertGolden(path, r.String())
+}
+
+// AssertGoldenJSON is AssertGolden for the JSON transcript.
+func (r *Recorder) AssertGoldenJSON(path string) {
+	r.tb.Helper()
+
+	got, err := r.JSON()
+	if err != nil {
+		r.tb.Fatalf("telestagetest: %v", err)
+	}
+	r.assertGolden(path, string(got))
+}
+
+func (r *Recorder) assertGolden(path, got string) {
+	r.tb.Helper()
+
+	if os.Getenv(UpdateGoldenEnv) != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			r.tb.Fatalf("telestagetest: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			r.tb.Fatalf("telestagetest: %v", err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		r.tb.Fatalf("telestagetest: %v (set %s=1 to create it)", err, UpdateGoldenEnv)
+	}
+	if string(want) != got {
+		r.tb.Errorf("transcript differs from %s (set %s=1 to update):\n%s", path, UpdateGoldenEnv, diff(string(want), got))
+	}
+}
+
+func formatUpdate(upd tgbotapi.Update) string {
+	switch {
+	case upd.Message != nil:
+		return "message " + formatMessage(upd.Message)
+	case upd.EditedMessage != nil:
+		return "edited_message " + formatMessage(upd.EditedMessage)
+	case upd.CallbackQuery != nil:
+		q := upd.CallbackQuery
+		s := "callback_query"
+		if q.From != nil {
+			s += fmt.Sprintf(" from=%d", q.From.ID)
+		}
+		if q.Message != nil {
+			s += fmt.Sprintf(" message_id=%d", q.Message.MessageID)
+		}
+		return s + " data=" + strconv.Quote(q.Data)
+	default:
+		data, _ := json.Marshal(upd)
+		return "update " + string(data)
+	}
+}
+
+func formatMessage(m *tgbotapi.Message) string {
+	var fields []string
+	if m.From != nil {
+		fields = append(fields, fmt.Sprintf("from=%d", m.From.ID))
+	}
+	if m.Chat != nil {
+		fields = append(fields, fmt.Sprintf("chat=%d", m.Chat.ID))
+	}
+	if m.Text != "" {
+		fields = append(fields, "text="+strconv.Quote(m.Text))
+	}
+	if m.Caption != "" {
+		fields = append(fields, "caption="+strconv.Quote(m.Caption))
+	}
+	if len(m.Photo) > 0 {
+		fields = append(fields, "photo")
+	}
+	if m.Sticker != nil {
+		fields = append(fields, "sticker")
+	}
+	return strings.Join(fields, " ")
+}
+
+func formatCall(c Call) string {
+	keys := make([]string, 0, len(c.Params)+len(c.Files))
+	for k := range c.Params {
+		keys = append(keys, k)
+	}
+	for k := range c.Files {
+		if _, ok := c.Params[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	fields := []string{c.Method}
+	for _, k := range keys {
+		if name, ok := c.Files[k]; ok {
+			fields = append(fields, k+"=@"+name)
+			continue
+		}
+		fields = append(fields, k+"="+strconv.Quote(c.Params.Get(k)))
+	}
+	return strings.Join(fields, " ")
+}
+
+// diff returns a line diff of want and got, prefixing removed lines with
+// "-", added lines with "+" and common lines with a space.
+func diff(want, got string) string {
+	a := strings.Split(want, "\n")
+	b := strings.Split(got, "\n")
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var out strings.Builder
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			out.WriteString("  " + a[i] + "\n")
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			out.WriteString("- " + a[i] + "\n")
+			i++
+		default:
+			out.WriteString("+ " + b[j] + "\n")
+			j++
+		}
+	}
+	return out.String()
+}
@@ -0,0 +1,109 @@
+package telestagetest
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/askoldex/telestage"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newScenesStage() *telestage.Stage {
+	states := map[int64]string{}
+	stg := telestage.NewStage(func(ctx telestage.Context) string {
+		if state, ok := states[ctx.Sender().ID]; ok {
+			return state
+		}
+		return "main"
+	})
+
+	mainScene := telestage.NewScene()
+	mainScene.OnStart(func(ctx telestage.Context) {
+		ctx.ReplyHTML("Hello, <b>send</b>: /enter")
+	})
+	mainScene.OnCommand("enter", func(ctx telestage.Context) {
+		states[ctx.Sender().ID] = "message"
+		ctx.Reply("Now send anything")
+	})
+
+	messageScene := telestage.NewScene()
+	messageScene.OnCommand("leave", func(ctx telestage.Context) {
+		delete(states, ctx.Sender().ID)
+		ctx.Reply("Bye")
+	})
+	messageScene.OnMessage(func(ctx telestage.Context) {
+		ctx.Reply("You said: " + ctx.Text())
+	})
+
+	stg.Add("main", mainScene)
+	stg.Add("message", messageScene)
+
+	return stg
+}
+
+func TestRecorder_AssertGolden(t *testing.T) {
+	rec := NewRecorder(t, newScenesStage().Run)
+
+	rec.Message(1, "/start")
+	rec.Message(1, "/enter")
+	rec.Message(1, "hello")
+	rec.Message(1, "/leave")
+	rec.Message(1, "unknown")
+
+	rec.AssertGolden("testdata/scenes.golden")
+}
+
+func TestRecorder_AssertGoldenJSON(t *testing.T) {
+	rec := NewRecorder(t, newScenesStage().Run)
+
+	rec.Message(1, "/start")
+	rec.Message(1, "hello")
+
+	rec.AssertGoldenJSON("testdata/scenes.json.golden")
+}
+
+func TestRecorder_MessageID(t *testing.T) {
+	s := telestage.NewScene()
+	s.OnCommand("album", func(ctx telestage.Context) {
+		ctx.ReplyMediaGroup([]interface{}{
+			tgbotapi.NewInputMediaPhoto(tgbotapi.FileID("a")),
+			tgbotapi.NewInputMediaPhoto(tgbotapi.FileID("b")),
+			tgbotapi.NewInputMediaPhoto(tgbotapi.FileID("c")),
+		})
+	})
+	s.OnMessage(func(ctx telestage.Context) {
+		ctx.ReplyTo("quoted")
+	})
+	stg := telestage.NewStage(func(telestage.Context) string { return "main" })
+	stg.Add("main", s)
+	rec := NewRecorder(t, stg.Run)
+
+	rec.Message(1, "/album")
+	rec.Message(1, "quote me")
+
+	calls := rec.Server().CallsTo("sendMessage")
+	require.Len(t, calls, 1)
+	id, err := strconv.Atoi(calls[0].Params.Get("reply_to_message_id"))
+	require.NoError(t, err)
+	m, ok := rec.Server().Message(1, id)
+	require.True(t, ok)
+	assert.Equal(t, "quote me", m.Text, "user message must not reuse the IDs of the album")
+}
+
+func TestRecorder_HandlerError(t *testing.T) {
+	stg := telestage.NewStage(func(_ telestage.Context) string { return "missing" })
+	rec := NewRecorder(t, stg.Run)
+
+	rec.Message(1, "hi")
+
+	entries := rec.Entries()
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "!! scene not found with name missing", entries[1].String())
+}
+
+func TestDiff(t *testing.T) {
+	got := diff("a\nb\nc", "a\nx\nc")
+	assert.Equal(t, "  a\n- b\n+ x\n  c\n", got)
+}
@@ -0,0 +1,281 @@
+package telestage
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const throttledKey = "telestage.throttled"
+
+// ThrottleAction is what Throttle does with an update exceeding a limit.
+type ThrottleAction int
+
+const (
+	// ThrottleDrop silently drops the updates exceeding the limit.
+	ThrottleDrop ThrottleAction = iota
+	// ThrottleWarn drops the updates exceeding the limit and notifies the
+	// user once, on the first update over the limit.
+	ThrottleWarn
+	// ThrottleBan notifies the user and drops all updates of the user or the
+	// chat exceeding the limit until the cooldown passes.
+	ThrottleBan
+)
+
+// ThrottleStore keeps the recent updates and the bans of users and chats,
+// a shared store makes limits work across several instances of the bot.
+type ThrottleStore interface {
+	// Hit records an update with the key at now and returns the number of
+	// updates with the key within the window before now, including this one.
+	Hit(key string, now time.Time, window time.Duration) (int, error)
+	// Ban bans the key until the time.
+	Ban(key string, until time.Time) error
+	// BannedUntil returns the end of the ban of the key, the zero time if not banned.
+	BannedUntil(key string, now time.Time) (time.Time, error)
+}
+
+// MemoryThrottleStore is an in-memory ThrottleStore.
+type MemoryThrottleStore struct {
+	lock   sync.Mutex
+	hits   map[string]throttleHits
+	bans   map[string]time.Time
+	pruned time.Time
+}
+
+// throttleHits are the recent updates of a key with the window of its limit
+type throttleHits struct {
+	times  []time.Time
+	window time.Duration
+}
+
+func NewMemoryThrottleStore() *MemoryThrottleStore {
+	return &MemoryThrottleStore{
+		hits: map[string]throttleHits{},
+		bans: map[string]time.Time{},
+	}
+}
+
+func (s *MemoryThrottleStore) Hit(key string, now time.Time, window time.Duration) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	times := append(recentHits(s.hits[key].times, now, window), now)
+	s.hits[key] = throttleHits{times: times, window: window}
+	s.prune(now, window)
+	return len(times), nil
+}
+
+func (s *MemoryThrottleStore) Ban(key string, until time.Time) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.bans[key] = until
+	return nil
+}
+
+func (s *MemoryThrottleStore) BannedUntil(key string, now time.Time) (time.Time, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	until, ok := s.bans[key]
+	if !ok {
+		return time.Time{}, nil
+	}
+	if !until.After(now) {
+		delete(s.bans, key)
+		return time.Time{}, nil
+	}
+	return until, nil
+}
+
+// prune forgets the keys without recent updates once per window, every
+// key is pruned with its own window
+func (s *MemoryThrottleStore) prune(now time.Time, window time.Duration) {
+	if now.Sub(s.pruned) < window {
+		return
+	}
+	s.pruned = now
+	for key, hits := range s.hits {
+		if hits.times = recentHits(hits.times, now, hits.window); len(hits.times) == 0 {
+			delete(s.hits, key)
+		} else {
+			s.hits[key] = hits
+		}
+	}
+}
+
+// recentHits returns the hits within the window before now, hits are sorted by time
+func recentHits(hits []time.Time, now time.Time, window time.Duration) []time.Time {
+	for i, t := range hits {
+		if now.Sub(t) < window {
+			return hits[i:]
+		}
+	}
+	return hits[:0]
+}
+
+// Throttle limits the updates handled per user and per chat in sliding
+// windows. Every update counts towards the limits, including the dropped ones,
+// so a user keeps being throttled while flooding.
+//
+//	throttle := telestage.NewThrottle(telestage.Limit{Count: 5, Per: 10 * time.Second})
+//	throttle.Action = telestage.ThrottleBan
+//	throttle.Exempt = isAdmin
+//	scene.Use(throttle.Middleware())
+type Throttle struct {
+	// PerUser is the limit of updates of a user in all chats.
+	PerUser Limit
+	// PerChat is the limit of updates from all users of a chat.
+	PerChat Limit
+	Action  ThrottleAction
+	// Cooldown is the duration of bans of ThrottleBan.
+	Cooldown time.Duration
+	// Exempt, if set, reports whether the update is not throttled, e.g. sent by an admin.
+	Exempt func(Context) bool
+	// Notify notifies the user about exceeding the limit, until is the end of
+	// the ban or the zero time for ThrottleWarn. It replies with a text by default.
+	Notify func(ctx Context, until time.Time)
+	// OnError, if set, is called when the store fails. The update is handled
+	// then, unless it exceeded the limit and the ban failed.
+	OnError func(Context, error)
+	Store   ThrottleStore
+}
+
+// NewThrottle creates a Throttle with the limit per user, dropping updates over it.
+func NewThrottle(perUser Limit) *Throttle {
+	return &Throttle{
+		PerUser:  perUser,
+		Cooldown: time.Minute,
+		Notify:   notifyThrottled,
+		Store:    NewMemoryThrottleStore(),
+	}
+}
+
+func notifyThrottled(ctx Context, until time.Time) {
+	text := "Too many requests, please slow down."
+	if !until.IsZero() {
+		text = fmt.Sprintf("Too many requests, try again in %s.", time.Until(until).Round(time.Second))
+	}
+	if q := ctx.Upd().CallbackQuery; q != nil {
+		_, _ = ctx.Bot().Request(tgbotapi.NewCallback(q.ID, text))
+		return
+	}
+	if ctx.Chat() != nil {
+		_, _ = ctx.Send(text)
+	}
+}
+
+// Middleware drops the updates exceeding the limits, aborting their handling.
+// An update is counted once, even if it runs through the middleware of
+// several routes because of Skip.
+func (t *Throttle) Middleware() Middleware {
+	key := fmt.Sprintf("%s.%p", throttledKey, t)
+	return func(next EventFn) EventFn {
+		return func(ctx Context) {
+			allowed, ok := ctx.Get(key).(bool)
+			if !ok {
+				allowed = t.allow(ctx, time.Now())
+				ctx.Set(key, allowed)
+			}
+			if !allowed {
+				Abort(ctx)
+				return
+			}
+			next(ctx)
+		}
+	}
+}
+
+// allow reports whether the update is within the limits, taking the action otherwise
+func (t *Throttle) allow(ctx Context, now time.Time) bool {
+	if t.Exempt != nil && t.Exempt(ctx) {
+		return true
+	}
+
+	type check struct {
+		key   string
+		limit Limit
+	}
+	var checks []check
+	if u := ctx.Sender(); u != nil && t.PerUser.Count > 0 {
+		checks = append(checks, check{"user:" + strconv.FormatInt(u.ID, 10), t.PerUser})
+	}
+	if c := ctx.Chat(); c != nil && t.PerChat.Count > 0 {
+		checks = append(checks, check{"chat:" + strconv.FormatInt(c.ID, 10), t.PerChat})
+	}
+
+	allowed, notify := true, false
+	var until time.Time
+	for _, c := range checks {
+		v, err := t.hit(c.key, c.limit, now)
+		if err != nil {
+			t.fail(ctx, err)
+		}
+		allowed = allowed && v.allowed
+		if v.notify {
+			notify = true
+			if v.until.After(until) {
+				until = v.until
+			}
+		}
+	}
+	// the user is notified once, even if the update exceeded several limits
+	if notify {
+		t.notify(ctx, until)
+	}
+	return allowed
+}
+
+// throttleVerdict is the result of counting an update against a limit
+type throttleVerdict struct {
+	allowed bool
+	// notify is set when the user must be notified, until is the end of the ban
+	notify bool
+	until  time.Time
+}
+
+// hit counts the update with the key against the limit, banning the key
+// when the limit is exceeded with ThrottleBan
+func (t *Throttle) hit(key string, limit Limit, now time.Time) (throttleVerdict, error) {
+	if t.Action == ThrottleBan {
+		until, err := t.Store.BannedUntil(key, now)
+		if err != nil {
+			return throttleVerdict{allowed: true}, err
+		}
+		if !until.IsZero() {
+			return throttleVerdict{}, nil
+		}
+	}
+
+	n, err := t.Store.Hit(key, now, limit.Per)
+	if err != nil || n <= limit.Count {
+		return throttleVerdict{allowed: true}, err
+	}
+
+	switch t.Action {
+	case ThrottleWarn:
+		return throttleVerdict{notify: n == limit.Count+1}, nil
+	case ThrottleBan:
+		until := now.Add(t.Cooldown)
+		if err := t.Store.Ban(key, until); err != nil {
+			return throttleVerdict{}, err
+		}
+		return throttleVerdict{notify: true, until: until}, nil
+	}
+	return throttleVerdict{}, nil
+}
+
+func (t *Throttle) notify(ctx Context, until time.Time) {
+	if t.Notify != nil {
+		t.Notify(ctx, until)
+	}
+}
+
+func (t *Throttle) fail(ctx Context, err error) {
+	if t.OnError != nil {
+		t.OnError(ctx, fmt.Errorf("throttle: %w", err))
+	}
+}
@@ -0,0 +1,190 @@
+package telestage
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryThrottleStore(t *testing.T) {
+	s := NewMemoryThrottleStore()
+	start := time.Unix(1000, 0)
+
+	for i := 1; i <= 3; i++ {
+		n, err := s.Hit("user:1", start.Add(time.Duration(i)*time.Second), 10*time.Second)
+		require.NoError(t, err)
+		assert.Equal(t, i, n)
+	}
+	n, _ := s.Hit("user:1", start.Add(11*time.Second), 10*time.Second)
+	assert.Equal(t, 3, n, "the hit at 1s left the window")
+	n, _ = s.Hit("user:2", start.Add(30*time.Second), 10*time.Second)
+	assert.Equal(t, 1, n)
+	assert.NotContains(t, s.hits, "user:1", "pruned")
+
+	require.NoError(t, s.Ban("user:1", start.Add(time.Minute)))
+	until, err := s.BannedUntil("user:1", start)
+	require.NoError(t, err)
+	assert.Equal(t, start.Add(time.Minute), until)
+	until, _ = s.BannedUntil("user:1", start.Add(time.Minute))
+	assert.True(t, until.IsZero())
+}
+
+func TestThrottle_MixedWindows(t *testing.T) {
+	now := time.Unix(1000, 0)
+	th := NewThrottle(Limit{Count: 2, Per: time.Minute})
+	th.PerChat = Limit{Count: 100, Per: time.Second}
+
+	assert.True(t, th.allow(groupMessage(-1, 1, "a"), now))
+	assert.True(t, th.allow(groupMessage(-1, 1, "b"), now.Add(2*time.Second)))
+	assert.False(t, th.allow(groupMessage(-1, 1, "c"), now.Add(4*time.Second)),
+		"pruning the chat window must keep the user hits")
+}
+
+func TestThrottle_Actions(t *testing.T) {
+	now := time.Unix(1000, 0)
+	limit := Limit{Count: 2, Per: 10 * time.Second}
+
+	run := func(th *Throttle, times ...time.Duration) (allowed []bool, notified []time.Time) {
+		th.Notify = func(_ Context, until time.Time) {
+			notified = append(notified, until)
+		}
+		for _, d := range times {
+			allowed = append(allowed, th.allow(groupMessage(-1, 1, "hi"), now.Add(d)))
+		}
+		return allowed, notified
+	}
+
+	th := NewThrottle(limit)
+	allowed, notified := run(th, 0, time.Second, 2*time.Second, 3*time.Second, 15*time.Second)
+	assert.Equal(t, []bool{true, true, false, false, true}, allowed)
+	assert.Empty(t, notified)
+
+	th = NewThrottle(limit)
+	th.Action = ThrottleWarn
+	allowed, notified = run(th, 0, time.Second, 2*time.Second, 3*time.Second)
+	assert.Equal(t, []bool{true, true, false, false}, allowed)
+	assert.Equal(t, []time.Time{{}}, notified, "warned once")
+
+	th = NewThrottle(limit)
+	th.Action = ThrottleBan
+	th.Cooldown = time.Minute
+	allowed, notified = run(th, 0, time.Second, 2*time.Second, 30*time.Second, 63*time.Second)
+	assert.Equal(t, []bool{true, true, false, false, true}, allowed)
+	assert.Equal(t, []time.Time{now.Add(62 * time.Second)}, notified)
+}
+
+func TestThrottle_NotifyOnce(t *testing.T) {
+	now := time.Unix(1000, 0)
+	th := NewThrottle(Limit{Count: 1, Per: time.Minute})
+	th.PerChat = Limit{Count: 1, Per: time.Minute}
+	th.Action = ThrottleBan
+	var notified []time.Time
+	th.Notify = func(_ Context, until time.Time) {
+		notified = append(notified, until)
+	}
+
+	assert.True(t, th.allow(groupMessage(-1, 1, "a"), now))
+	assert.False(t, th.allow(groupMessage(-1, 1, "b"), now), "both limits exceeded")
+	assert.Equal(t, []time.Time{now.Add(time.Minute)}, notified, "notified once per update")
+
+	th.Action = ThrottleWarn
+	th.Store = NewMemoryThrottleStore()
+	notified = nil
+	assert.True(t, th.allow(groupMessage(-1, 1, "a"), now))
+	assert.False(t, th.allow(groupMessage(-1, 1, "b"), now))
+	assert.Equal(t, []time.Time{{}}, notified)
+}
+
+func TestThrottle_PerChat(t *testing.T) {
+	now := time.Unix(1000, 0)
+	th := NewThrottle(Limit{})
+	th.PerChat = Limit{Count: 2, Per: time.Minute}
+	th.Exempt = func(ctx Context) bool { return ctx.Sender().ID == 99 }
+
+	assert.True(t, th.allow(groupMessage(-1, 1, "a"), now))
+	assert.True(t, th.allow(groupMessage(-1, 2, "b"), now))
+	assert.False(t, th.allow(groupMessage(-1, 3, "c"), now))
+	assert.True(t, th.allow(groupMessage(-2, 3, "c"), now), "other chat")
+	assert.True(t, th.allow(groupMessage(-1, 99, "admin"), now), "exempt")
+}
+
+type failingThrottleStore struct {
+	*MemoryThrottleStore
+}
+
+func (failingThrottleStore) Hit(string, time.Time, time.Duration) (int, error) {
+	return 0, errors.New("store down")
+}
+
+func TestThrottle_StoreError(t *testing.T) {
+	var errs []error
+	th := NewThrottle(Limit{Count: 1, Per: time.Minute})
+	th.Store = failingThrottleStore{NewMemoryThrottleStore()}
+	th.OnError = func(_ Context, err error) {
+		errs = append(errs, err)
+	}
+
+	assert.True(t, th.allow(groupMessage(-1, 1, "a"), time.Now()))
+	require.Len(t, errs, 1)
+	assert.EqualError(t, errs[0], "throttle: store down")
+}
+
+func TestThrottle_Middleware(t *testing.T) {
+	srv, bot := newTestBot(t)
+
+	var handled int
+	s := NewScene()
+	s.Use(NewThrottle(Limit{Count: 1, Per: time.Minute}).Middleware())
+	s.OnMessage(func(Context) {
+		handled++
+	})
+	var after int
+	s.After(func(Context) { after++ })
+	stage := NewStage(func(Context) string { return "main" })
+	stage.Add("main", s)
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, stage.Run(bot, userMessage(1, i+1, "spam")))
+	}
+	assert.Equal(t, 1, handled)
+	assert.Equal(t, 1, after, "dropped updates must be aborted")
+	assert.Empty(t, srv.CallsTo("sendMessage"), "dropped silently")
+}
+
+func TestThrottle_Skip(t *testing.T) {
+	skipStickers := func(next EventFn) EventFn {
+		return func(ctx Context) {
+			if ctx.Message().Sticker != nil && RouteName(ctx) != "sticker" {
+				Skip(ctx)
+				return
+			}
+			next(ctx)
+		}
+	}
+	throttle := NewThrottle(Limit{Count: 2, Per: time.Minute})
+	throttle.Action = ThrottleBan
+
+	var handled []string
+	s := NewScene()
+	s.Use(throttle.Middleware(), skipStickers)
+	s.OnMessage(func(Context) { handled = append(handled, "message") })
+	s.OnSticker(func(Context) { handled = append(handled, "sticker") })
+	stage := NewStage(func(Context) string { return "main" })
+	stage.Add("main", s)
+
+	sticker := func(id int) tgbotapi.Update {
+		upd := userMessage(1, id, "")
+		upd.Message.Sticker = &tgbotapi.Sticker{FileID: "s"}
+		return upd
+	}
+	require.NoError(t, stage.Run(&tgbotapi.BotAPI{}, sticker(1)))
+	require.NoError(t, stage.Run(&tgbotapi.BotAPI{}, sticker(2)))
+	assert.Equal(t, []string{"sticker", "sticker"}, handled, "skipped routes must not count the update again")
+
+	n, _ := throttle.Store.Hit("user:1", time.Now(), time.Minute)
+	assert.Equal(t, 3, n)
+}
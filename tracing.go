@@ -0,0 +1,205 @@
+package telestage
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	tracerKey = "telestage.tracer"
+	spanKey   = "telestage.span"
+)
+
+// Tracer starts spans, e.g. an adapter of an OpenTelemetry tracer.
+type Tracer interface {
+	// Start starts a span, parent is nil for the span of an update.
+	Start(parent Span, name string) Span
+}
+
+// Span is an operation traced by a Tracer.
+type Span interface {
+	SetAttribute(key string, value interface{})
+	SetError(err error)
+	End()
+}
+
+// SetTracer traces updates run by the stage: a span per update, child spans
+// per middleware and handler of the matched route, and per Bot API request.
+func (s *Stage) SetTracer(t Tracer) {
+	s.tracer = t
+}
+
+// startUpdateSpan starts the span of the update and makes it current for the context
+func (s *Stage) startUpdateSpan(ctx Context) Span {
+	span := s.tracer.Start(nil, "update")
+	span.SetAttribute("update.id", ctx.Upd().UpdateID)
+	span.SetAttribute("update.type", UpdateType(ctx.Upd()))
+	if c := ctx.Chat(); c != nil {
+		span.SetAttribute("chat.id", c.ID)
+	}
+	if u := ctx.Sender(); u != nil {
+		span.SetAttribute("user.id", u.ID)
+	}
+
+	ctx.Set(tracerKey, s.tracer)
+	ctx.Set(spanKey, span)
+	return span
+}
+
+// endUpdateSpan ends the span of the update, the panic of the handler is propagated
+func endUpdateSpan(ctx Context, span Span, err *error) {
+	p := recover()
+	span.SetAttribute("scene", SceneName(ctx))
+	span.SetAttribute("route", RouteName(ctx))
+	if *err != nil {
+		span.SetError(*err)
+	}
+	if p != nil {
+		span.SetError(fmt.Errorf("panic: %v", p))
+	}
+	span.End()
+	if p != nil {
+		panic(p)
+	}
+}
+
+// traced runs ef in a child span of the current span, when the update is traced
+func traced(name func(Context) string, ef EventFn) EventFn {
+	return func(ctx Context) {
+		tracer, _ := ctx.Get(tracerKey).(Tracer)
+		if tracer == nil {
+			ef(ctx)
+			return
+		}
+
+		parent, _ := ctx.Get(spanKey).(Span)
+		span := tracer.Start(parent, name(ctx))
+		ctx.Set(spanKey, span)
+		defer func() {
+			ctx.Set(spanKey, parent)
+			if p := recover(); p != nil {
+				span.SetError(fmt.Errorf("panic: %v", p))
+				span.End()
+				panic(p)
+			}
+			span.End()
+		}()
+
+		ef(ctx)
+	}
+}
+
+// traceClient traces requests in child spans of the current span of the context
+func traceClient(tracer Tracer, ctx Context) ClientMiddleware {
+	return func(next tgbotapi.HTTPClient) tgbotapi.HTTPClient {
+		return ClientFunc(func(req *http.Request) (*http.Response, error) {
+			parent, _ := ctx.Get(spanKey).(Span)
+			method := apiMethod(req)
+			span := tracer.Start(parent, "api "+method)
+			span.SetAttribute("api.method", method)
+			defer span.End()
+
+			resp, err := next.Do(req)
+			if err != nil {
+				span.SetError(err)
+				return resp, err
+			}
+			span.SetAttribute("http.status_code", resp.StatusCode)
+			if resp.StatusCode != http.StatusOK {
+				span.SetError(fmt.Errorf("bot api: %s", resp.Status))
+			}
+			return resp, nil
+		})
+	}
+}
+
+// RecordedSpan is a span finished in a MemoryTracer.
+type RecordedSpan struct {
+	ID int
+	// ParentID is 0 for the span of an update.
+	ParentID   int
+	Name       string
+	Attributes map[string]interface{}
+	Err        error
+	Start, End time.Time
+}
+
+// MemoryTracer is a Tracer recording spans in memory, e.g. for tests.
+type MemoryTracer struct {
+	lock   sync.Mutex
+	nextID int
+	spans  []RecordedSpan
+}
+
+func NewMemoryTracer() *MemoryTracer {
+	return &MemoryTracer{}
+}
+
+func (t *MemoryTracer) Start(parent Span, name string) Span {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.nextID++
+	s := &memorySpan{tracer: t, RecordedSpan: RecordedSpan{
+		ID:         t.nextID,
+		Name:       name,
+		Attributes: map[string]interface{}{},
+		Start:      time.Now(),
+	}}
+	if p, ok := parent.(*memorySpan); ok {
+		s.ParentID = p.ID
+	}
+	return s
+}
+
+// Spans returns the finished spans in the order they ended.
+func (t *MemoryTracer) Spans() []RecordedSpan {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return append([]RecordedSpan(nil), t.spans...)
+}
+
+// Reset forgets the recorded spans.
+func (t *MemoryTracer) Reset() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.spans = nil
+}
+
+type memorySpan struct {
+	RecordedSpan
+	tracer *MemoryTracer
+	lock   sync.Mutex
+}
+
+func (s *memorySpan) SetAttribute(key string, value interface{}) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.Attributes[key] = value
+}
+
+func (s *memorySpan) SetError(err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.Err = err
+}
+
+func (s *memorySpan) End() {
+	s.lock.Lock()
+	s.RecordedSpan.End = time.Now()
+	recorded := s.RecordedSpan
+	s.lock.Unlock()
+
+	s.tracer.lock.Lock()
+	defer s.tracer.lock.Unlock()
+
+	s.tracer.spans = append(s.tracer.spans, recorded)
+}
@@ -0,0 +1,89 @@
+package telestage
+
+import (
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func noopMiddleware(next EventFn) EventFn {
+	return next
+}
+
+func TestTracing(t *testing.T) {
+	srv, bot := newTestBot(t)
+	srv.FailNext("sendMessage", 403, "Forbidden: bot was blocked by the user", 0)
+
+	tracer := NewMemoryTracer()
+	s := NewScene()
+	s.Use(noopMiddleware)
+	s.OnCommand("start", func(ctx Context) {
+		ctx.Reply("hi")
+	})
+	stage := NewStage(func(Context) string { return "main" })
+	stage.Add("main", s)
+	stage.SetTracer(tracer)
+
+	upd := userMessage(1, 10, "/start")
+	upd.UpdateID = 5
+	upd.Message.Entities = []tgbotapi.MessageEntity{{Type: "bot_command", Length: 6}}
+	require.NoError(t, stage.Run(bot, upd))
+
+	spans := tracer.Spans()
+	require.Len(t, spans, 4)
+	api, handler, mw, update := spans[0], spans[1], spans[2], spans[3]
+
+	assert.Equal(t, "update", update.Name)
+	assert.Zero(t, update.ParentID)
+	assert.Equal(t, 5, update.Attributes["update.id"])
+	assert.Equal(t, "message", update.Attributes["update.type"])
+	assert.Equal(t, int64(1), update.Attributes["chat.id"])
+	assert.Equal(t, "main", update.Attributes["scene"])
+	assert.Equal(t, "command:start", update.Attributes["route"])
+	assert.NoError(t, update.Err)
+
+	assert.Equal(t, "middleware telestage.noopMiddleware", mw.Name)
+	assert.Equal(t, update.ID, mw.ParentID)
+	assert.Equal(t, "handler command:start", handler.Name)
+	assert.Equal(t, mw.ID, handler.ParentID)
+
+	assert.Equal(t, "api sendMessage", api.Name)
+	assert.Equal(t, handler.ID, api.ParentID)
+	assert.Equal(t, "sendMessage", api.Attributes["api.method"])
+	assert.Equal(t, 403, api.Attributes["http.status_code"])
+	assert.Error(t, api.Err)
+}
+
+func TestTracing_Errors(t *testing.T) {
+	tracer := NewMemoryTracer()
+	s := NewScene()
+	s.OnMessage(func(Context) {
+		panic("boom")
+	})
+	stage := NewStage(func(ctx Context) string { return ctx.Text() })
+	stage.Add("main", s)
+	stage.SetTracer(tracer)
+
+	assert.PanicsWithValue(t, "boom", func() {
+		_ = stage.Run(&tgbotapi.BotAPI{}, userMessage(1, 10, "main"))
+	})
+	spans := tracer.Spans()
+	require.Len(t, spans, 2)
+	assert.EqualError(t, spans[0].Err, "panic: boom")
+	assert.EqualError(t, spans[1].Err, "panic: boom")
+
+	tracer.Reset()
+	assert.Error(t, stage.Run(&tgbotapi.BotAPI{}, userMessage(1, 10, "missing")))
+	spans = tracer.Spans()
+	require.Len(t, spans, 1)
+	assert.ErrorIs(t, spans[0].Err, ErrSceneNotFound)
+}
+
+func TestTracing_Disabled(t *testing.T) {
+	var called bool
+	ef := applyMiddleware(func(Context) { called = true }, noopMiddleware)
+	ef(&NativeContext{})
+	assert.True(t, called)
+}
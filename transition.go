@@ -0,0 +1,173 @@
+package telestage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrTransitionNotAllowed = errors.New("transition not allowed")
+	ErrSceneUnreachable     = errors.New("scene unreachable")
+	ErrNoStateSetter        = errors.New("state setter not set")
+)
+
+// StateSetter persists the state of the user of the update.
+type StateSetter func(ctx Context, state string) error
+
+// TransitionError is the error of a transition to a missing scene, wrapping
+// ErrSceneNotFound, or to a scene not allowed from the current one, wrapping
+// ErrTransitionNotAllowed.
+type TransitionError struct {
+	From, To string
+	Err      error
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("transition from %q to %q: %v", e.From, e.To, e.Err)
+}
+
+func (e *TransitionError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationError lists the problems found by Stage.Validate.
+type ValidationError struct {
+	Errors []error
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return "invalid stage: " + strings.Join(msgs, "; ")
+}
+
+// AllowTransitions declares the states of the scenes users may move to from
+// this scene. The targets of the routes set with Route.To are allowed too.
+// A scene without declared transitions allows moving to any scene.
+func (s *Scene) AllowTransitions(states ...string) {
+	s.transitions = append(s.transitions, states...)
+}
+
+// AllowedTransitions returns the declared transitions and the targets of the routes, without duplicates.
+func (s *Scene) AllowedTransitions() []string {
+	var states []string
+	seen := map[string]bool{}
+	add := func(state string) {
+		if !seen[state] {
+			seen[state] = true
+			states = append(states, state)
+		}
+	}
+	for _, state := range s.transitions {
+		add(state)
+	}
+	for _, r := range s.routes {
+		for _, state := range r.targets {
+			add(state)
+		}
+	}
+	return states
+}
+
+// SetStateSetter sets the function persisting states on Stage.Transition.
+func (s *Stage) SetStateSetter(setter StateSetter) {
+	s.stateSetter = setter
+}
+
+// CheckTransition returns a *TransitionError if the scene with the state to
+// does not exist or is not allowed from the scene with the state from.
+func (s *Stage) CheckTransition(from, to string) error {
+	if _, ok := s.scenes[to]; !ok {
+		return &TransitionError{From: from, To: to, Err: ErrSceneNotFound}
+	}
+	scene, ok := s.scenes[from]
+	if !ok {
+		return nil
+	}
+	allowed := scene.AllowedTransitions()
+	if len(allowed) == 0 || from == to || contains(allowed, to) {
+		return nil
+	}
+	return &TransitionError{From: from, To: to, Err: ErrTransitionNotAllowed}
+}
+
+// Transition moves the user of the update to the scene with the state,
+// persisting it with the StateSetter once CheckTransition passes from the
+// scene handling the update. Outside of handlers, e.g. in scheduled jobs,
+// only the existence of the scene is checked.
+func (s *Stage) Transition(ctx Context, to string) error {
+	from, inScene := ctx.Get(sceneKey).(string)
+	if !inScene {
+		if _, ok := s.scenes[to]; !ok {
+			return &TransitionError{To: to, Err: ErrSceneNotFound}
+		}
+	} else if err := s.CheckTransition(from, to); err != nil {
+		return err
+	}
+
+	if s.stateSetter == nil {
+		return ErrNoStateSetter
+	}
+	return s.stateSetter(ctx, to)
+}
+
+// Validate checks at startup that the targets of all transitions exist and
+// that every scene is reachable from the initial states, returning a
+// *ValidationError listing the problems. Reachability is not checked when
+// no initial states are given.
+func (s *Stage) Validate(initial ...string) error {
+	var errs []error
+	for _, state := range initial {
+		if _, ok := s.scenes[state]; !ok {
+			errs = append(errs, fmt.Errorf("%w with name %q", ErrSceneNotFound, state))
+		}
+	}
+
+	states := s.Scenes()
+	for _, from := range states {
+		for _, to := range s.scenes[from].AllowedTransitions() {
+			if _, ok := s.scenes[to]; !ok {
+				errs = append(errs, &TransitionError{From: from, To: to, Err: ErrSceneNotFound})
+			}
+		}
+	}
+
+	if len(initial) > 0 {
+		errs = append(errs, s.unreachable(states, initial)...)
+	}
+
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+	return nil
+}
+
+// unreachable returns the errors of the states not reachable from the initial ones
+func (s *Stage) unreachable(states, initial []string) []error {
+	var errs []error
+	reached := map[string]bool{}
+	queue := append([]string{}, initial...)
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+		scene, ok := s.scenes[state]
+		if !ok || reached[state] {
+			continue
+		}
+		reached[state] = true
+		next := scene.AllowedTransitions()
+		if len(next) == 0 {
+			next = states
+		}
+		queue = append(queue, next...)
+	}
+	for _, state := range states {
+		if !reached[state] {
+			errs = append(errs, fmt.Errorf("%w: %q", ErrSceneUnreachable, state))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,117 @@
+package telestage
+
+import (
+	"errors"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func transitionStage() (*Stage, map[int64]string) {
+	states := map[int64]string{}
+	stage := NewStage(func(ctx Context) string {
+		if s, ok := states[ctx.Sender().ID]; ok {
+			return s
+		}
+		return "main"
+	})
+	stage.SetStateSetter(func(ctx Context, state string) error {
+		states[ctx.Sender().ID] = state
+		return nil
+	})
+
+	main := NewScene()
+	main.OnCommand("settings", func(Context) {}).To("settings")
+	main.AllowTransitions("order")
+	settings := NewScene()
+	settings.AllowTransitions("main")
+	order := NewScene()
+
+	stage.Add("main", main)
+	stage.Add("settings", settings)
+	stage.Add("order", order)
+	return stage, states
+}
+
+func TestStage_CheckTransition(t *testing.T) {
+	stage, _ := transitionStage()
+	main, _ := stage.Scene("main")
+	assert.Equal(t, []string{"order", "settings"}, main.AllowedTransitions())
+
+	assert.NoError(t, stage.CheckTransition("main", "settings"))
+	assert.NoError(t, stage.CheckTransition("main", "order"))
+	assert.NoError(t, stage.CheckTransition("order", "settings"), "no declared transitions")
+	assert.NoError(t, stage.CheckTransition("settings", "settings"))
+
+	err := stage.CheckTransition("settings", "order")
+	var terr *TransitionError
+	require.True(t, errors.As(err, &terr))
+	assert.Equal(t, "settings", terr.From)
+	assert.Equal(t, "order", terr.To)
+	assert.True(t, errors.Is(err, ErrTransitionNotAllowed))
+
+	err = stage.CheckTransition("main", "mian")
+	assert.True(t, errors.Is(err, ErrSceneNotFound))
+	assert.EqualError(t, err, `transition from "main" to "mian": scene not found`)
+}
+
+func TestStage_Transition(t *testing.T) {
+	stage, states := transitionStage()
+
+	var errs []error
+	main, _ := stage.Scene("main")
+	main.OnMessage(func(ctx Context) {
+		errs = append(errs, stage.Transition(ctx, ctx.Text()))
+	})
+
+	require.NoError(t, stage.Run(&tgbotapi.BotAPI{}, userMessage(1, 1, "mian")))
+	assert.NotContains(t, states, int64(1), "not persisted")
+	require.NoError(t, stage.Run(&tgbotapi.BotAPI{}, userMessage(1, 2, "settings")))
+	assert.Equal(t, "settings", states[1])
+
+	require.Len(t, errs, 2)
+	assert.True(t, errors.Is(errs[0], ErrSceneNotFound))
+	assert.NoError(t, errs[1])
+
+	upd := userMessage(2, 1, "hi")
+	ctx := &NativeContext{upd: &upd}
+	assert.NoError(t, stage.Transition(ctx, "order"), "outside of handlers only existence is checked")
+	assert.Equal(t, "order", states[2])
+
+	stage.SetStateSetter(nil)
+	assert.Equal(t, ErrNoStateSetter, stage.Transition(ctx, "main"))
+}
+
+func TestStage_Validate(t *testing.T) {
+	stage, _ := transitionStage()
+	assert.NoError(t, stage.Validate("main"))
+	assert.NoError(t, stage.Validate(), "reachability is not checked without initial states")
+
+	order, _ := stage.Scene("order")
+	order.AllowTransitions("main")
+
+	broken := NewScene()
+	broken.AllowTransitions("mian")
+	stage.Add("broken", broken)
+	island := NewScene()
+	island.AllowTransitions("main")
+	stage.Add("island", island)
+
+	err := stage.Validate("main", "start")
+	var verr *ValidationError
+	require.True(t, errors.As(err, &verr))
+	require.Len(t, verr.Errors, 4)
+	assert.True(t, errors.Is(verr.Errors[0], ErrSceneNotFound))
+	assert.True(t, errors.Is(verr.Errors[1], ErrSceneNotFound))
+	assert.True(t, errors.Is(verr.Errors[2], ErrSceneUnreachable))
+	assert.EqualError(t, err, `invalid stage: scene not found with name "start"; `+
+		`transition from "broken" to "mian": scene not found; `+
+		`scene unreachable: "broken"; scene unreachable: "island"`)
+
+	err = stage.Validate()
+	require.True(t, errors.As(err, &verr))
+	require.Len(t, verr.Errors, 1, "only the missing target is reported")
+	assert.True(t, errors.Is(verr.Errors[0], ErrSceneNotFound))
+}